@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hekmon/malradar/mal/radar"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	apiShutdownTimeout = 5 * time.Second
+)
+
+type apiServer struct {
+	server *http.Server
+	token  string
+}
+
+// startAPI starts the HTTP API in the background if it is enabled
+func startAPI(conf APIConfiguration) (api *apiServer) {
+	if conf.Listen == "" {
+		logger.Debug("[API] listen address unset: API disabled")
+		return
+	}
+	api = &apiServer{
+		token: conf.Token,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", api.method(http.MethodGet, api.dashboard))
+	mux.HandleFunc("/static/", api.method(http.MethodGet, dashboardStatic().ServeHTTP))
+	mux.HandleFunc("/api/status", api.method(http.MethodGet, api.status))
+	mux.HandleFunc("/api/watchlist", api.method(http.MethodGet, api.watchList))
+	mux.HandleFunc("/api/encountered", api.method(http.MethodGet, api.encountered))
+	mux.HandleFunc("/api/batch", api.method(http.MethodPost, api.batch))
+	mux.HandleFunc("/api/save", api.method(http.MethodPost, api.save))
+	mux.HandleFunc("/api/rebuild", api.method(http.MethodPost, api.rebuild))
+	if handler := metricsHandler(); handler != nil {
+		mux.HandleFunc("/metrics", api.method(http.MethodGet, handler.ServeHTTP))
+	}
+	api.server = &http.Server{
+		Addr:              conf.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		logger.Infof("[API] listening on %s", conf.Listen)
+		if err := api.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("[API] server failed: %v", err)
+		}
+	}()
+	return
+}
+
+// metricsHandler returns the Prometheus exposition handler of the watcher and process metrics
+func metricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if err := watcher.RegisterMetrics(registry); err != nil {
+		logger.Errorf("[API] can't register watcher metrics: metrics disabled: %v", err)
+		return nil
+	}
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+func (api *apiServer) stop() {
+	if api == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+	defer cancel()
+	if err := api.server.Shutdown(ctx); err != nil {
+		logger.Errorf("[API] can't shutdown server gracefully: %v", err)
+	}
+}
+
+// method restricts handler to the given HTTP method and checks the token if any.
+// Browsers can provide the token as the password of the basic authentication.
+func (api *apiServer) method(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			api.error(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		// browsers send the basic authentication along cross site requests too: the token does not protect against them
+		if method != http.MethodGet && crossSite(r) {
+			api.error(w, http.StatusForbidden, "cross site requests are not allowed")
+			return
+		}
+		if api.token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if _, password, ok := r.BasicAuth(); ok {
+				token = password
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="malradar"`)
+				api.error(w, http.StatusUnauthorized, "invalid or missing token")
+				return
+			}
+		}
+		logger.Debugf("[API] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		handler(w, r)
+	}
+}
+
+// crossSite returns true if the request has been sent by a browser from another site than the API one.
+// Requests without the Sec-Fetch-Site and Origin headers (curl, scripts, etc...) are not from a browser page.
+func crossSite(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site != "same-origin" && site != "none"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	parsed, err := url.Parse(origin)
+	return err != nil || parsed.Host != r.Host
+}
+
+func (api *apiServer) status(w http.ResponseWriter, r *http.Request) {
+	api.reply(w, http.StatusOK, watcher.Status())
+}
+
+func (api *apiServer) watchList(w http.ResponseWriter, r *http.Request) {
+	api.reply(w, http.StatusOK, watcher.WatchList())
+}
+
+func (api *apiServer) encountered(w http.ResponseWriter, r *http.Request) {
+	api.reply(w, http.StatusOK, watcher.Encountered())
+}
+
+func (api *apiServer) batch(w http.ResponseWriter, r *http.Request) {
+	if err := watcher.TriggerBatch(); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, radar.ErrBatchPending) {
+			code = http.StatusConflict
+		}
+		api.error(w, code, err.Error())
+		return
+	}
+	api.reply(w, http.StatusAccepted, map[string]string{"result": "batch requested"})
+}
+
+func (api *apiServer) save(w http.ResponseWriter, r *http.Request) {
+	logger.Info("[API] saving current state")
+	watcher.SaveStateNow()
+	api.reply(w, http.StatusOK, map[string]string{"result": "state saved"})
+}
+
+func (api *apiServer) rebuild(w http.ResponseWriter, r *http.Request) {
+	if err := watcher.ForceRebuild(); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, radar.ErrBatchPending) {
+			code = http.StatusConflict
+		}
+		api.error(w, code, err.Error())
+		return
+	}
+	api.reply(w, http.StatusAccepted, map[string]string{"result": "rebuild requested"})
+}
+
+func (api *apiServer) error(w http.ResponseWriter, code int, message string) {
+	api.reply(w, code, map[string]string{"error": message})
+}
+
+func (api *apiServer) reply(w http.ResponseWriter, code int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		logger.Errorf("[API] can't write response: %v", err)
+	}
+}
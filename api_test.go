@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCrossSite(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		cross   bool
+	}{
+		{name: "no browser headers", cross: false},
+		{name: "same origin fetch", headers: map[string]string{"Sec-Fetch-Site": "same-origin"}, cross: false},
+		{name: "user initiated", headers: map[string]string{"Sec-Fetch-Site": "none"}, cross: false},
+		{name: "cross site fetch", headers: map[string]string{"Sec-Fetch-Site": "cross-site"}, cross: true},
+		{name: "same site fetch", headers: map[string]string{"Sec-Fetch-Site": "same-site"}, cross: true},
+		{name: "same origin", headers: map[string]string{"Origin": "http://127.0.0.1:8080"}, cross: false},
+		{name: "other origin", headers: map[string]string{"Origin": "https://evil.example"}, cross: true},
+		{name: "opaque origin", headers: map[string]string{"Origin": "null"}, cross: true},
+	} {
+		r := httptest.NewRequest("POST", "http://127.0.0.1:8080/api/batch", nil)
+		for key, value := range tc.headers {
+			r.Header.Set(key, value)
+		}
+		if crossSite(r) != tc.cross {
+			t.Errorf("%s: cross site should be %v", tc.name, tc.cross)
+		}
+	}
+}
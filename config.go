@@ -5,49 +5,165 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hekmon/malradar/mal/radar"
 )
 
 // Configuration holds the user configuration
 type Configuration struct {
-	MAL struct {
-		MinScore   float64 `json:"minimum_score"`
-		User       string  `json:"user_to_check_against"`
-		Blacklists struct {
-			Genres []string `json:"genres"`
-			Types  []string `json:"types"`
-		} `json:"blacklists"`
+	StateDir  string                `json:"state_dir"`
+	Storage   radar.StorageConfig   `json:"storage"`
+	Schedule  radar.ScheduleConfig  `json:"schedule"`
+	RateLimit radar.RateLimitConfig `json:"rate_limit"`
+	Source    radar.SourceConfig    `json:"source"`
+	MAL       struct {
+		FiltersConfiguration
 		Init struct {
-			NbSeasons int  `json:"nb_of_seasons_to_scrape"`
-			Notify    bool `json:"notify_on_first_run"`
+			NbSeasons int    `json:"nb_of_seasons_to_scrape"`
+			Notify    bool   `json:"notify_on_first_run"`
+			OnError   string `json:"on_anime_error"`
 		} `json:"initialization"`
 	} `json:"myanimelist"`
-	Pushover struct {
-		UserKey        string `json:"user_key"`
-		ApplicationKey string `json:"application_key"`
-	} `json:"pushover"`
+	Pushover  *radar.PushoverConfig  `json:"pushover"` // kept for backward compatibility, see Notifiers
+	Notifiers radar.NotifiersConfig  `json:"notifiers"`
+	Templates radar.TemplatesConfig  `json:"templates"`
+	Profiles  []ProfileConfiguration `json:"profiles"`
+	API       APIConfiguration       `json:"api"`
+}
+
+// FiltersConfiguration holds the filtering part of the myanimelist configuration
+type FiltersConfiguration struct {
+	MinScore      float64 `json:"minimum_score"`
+	MinScoredBy   int     `json:"minimum_votes"`
+	MinMembers    int     `json:"minimum_members"`
+	MaxRank       int     `json:"maximum_rank"`
+	MaxPopularity int     `json:"maximum_popularity"`
+	CooldownDays  int     `json:"score_cooldown_days"`
+	User          string  `json:"user_to_check_against"`
+	Blacklists    struct {
+		Genres []string `json:"genres"`
+		Types  []string `json:"types"`
+	} `json:"blacklists"`
+	Whitelists struct {
+		Genres     []string `json:"genres"`
+		GenresMode string   `json:"genres_mode"`
+	} `json:"whitelists"`
+	Filters struct {
+		DefaultAction radar.FilterAction `json:"default_action"`
+		Rules         []radar.FilterRule `json:"rules"`
+	} `json:"filters"`
+}
+
+// APIConfiguration holds the configuration of the local HTTP status & control API
+type APIConfiguration struct {
+	Listen string `json:"listen"`
+	Token  string `json:"token"`
+}
+
+// ProfileConfiguration holds the configuration of a named watch profile
+type ProfileConfiguration struct {
+	Name      string                `json:"name"`
+	MAL       FiltersConfiguration  `json:"myanimelist"`
+	Notifiers radar.NotifiersConfig `json:"notifiers"`
+	Templates radar.TemplatesConfig `json:"templates"`
 }
 
 func getConfig(path string) (conf Configuration, err error) {
-	// Open file
-	var configFile *os.File
-	if configFile, err = os.Open(path); err != nil {
+	// Read file
+	data, err := os.ReadFile(path)
+	if err != nil {
 		err = fmt.Errorf("can't open '%s' for reading: %w", path, err)
 		return
 	}
-	defer configFile.Close()
 	// Parse it
-	if err = json.NewDecoder(configFile).Decode(&conf); err != nil {
+	if err = json.Unmarshal(data, &conf); err != nil {
 		err = fmt.Errorf("can't decode '%s' as JSON: %w", path, err)
 		return
 	}
+	// Handle legacy values
+	if conf.Pushover != nil {
+		conf.Notifiers.Pushover = append([]radar.PushoverConfig{*conf.Pushover}, conf.Notifiers.Pushover...)
+	}
 	// Check values
-	if conf.Pushover.ApplicationKey == "" {
-		err = errors.New("pushover application key must be set")
+	if len(conf.Profiles) == 0 {
+		if countNotifiers(conf.Notifiers) == 0 {
+			err = errors.New("at least one notifier must be configured")
+		}
+		return
+	}
+	// the top level filters are not used by the profiles: refuse them instead of silently ignoring them
+	var ignored []string
+	if ignored, err = topLevelFilterKeys(data); err != nil {
+		err = fmt.Errorf("can't decode '%s' as JSON: %w", path, err)
+		return
+	}
+	if len(ignored) > 0 {
+		err = fmt.Errorf("the top level myanimelist filter key(s) %s are not used when profiles are set: move them within the profiles",
+			strings.Join(ignored, ", "))
 		return
 	}
-	if conf.Pushover.UserKey == "" {
-		err = errors.New("pushover user key must be set")
+	names := make(map[string]bool, len(conf.Profiles))
+	for index, profile := range conf.Profiles {
+		if profile.Name == "" {
+			err = fmt.Errorf("profile #%d: name can't be empty", index+1)
+			return
+		}
+		if names[profile.Name] {
+			err = fmt.Errorf("profile name '%s' is used more than once", profile.Name)
+			return
+		}
+		names[profile.Name] = true
+		if countNotifiers(profile.Notifiers) == 0 {
+			err = fmt.Errorf("profile '%s': at least one notifier must be configured", profile.Name)
+			return
+		}
+	}
+	return
+}
+
+// topLevelFilterKeys returns the filter keys set within the top level myanimelist object
+func topLevelFilterKeys(data []byte) (keys []string, err error) {
+	var raw struct {
+		MAL map[string]json.RawMessage `json:"myanimelist"`
+	}
+	if err = json.Unmarshal(data, &raw); err != nil {
 		return
 	}
+	for key := range raw.MAL {
+		if key != "initialization" {
+			keys = append(keys, "'"+key+"'")
+		}
+	}
+	sort.Strings(keys)
 	return
 }
+
+func countNotifiers(conf radar.NotifiersConfig) int {
+	return len(conf.Pushover) + len(conf.Discord) + len(conf.Slack) +
+		len(conf.Webhook) + len(conf.SMTP) + len(conf.Gotify) + len(conf.Ntfy)
+}
+
+// profileConfig converts the filters configuration to a radar profile configuration
+func (fc FiltersConfiguration) profileConfig(name string, notifiers []radar.Notifier, templates *radar.Templates) radar.ProfileConfig {
+	return radar.ProfileConfig{
+		Name:                name,
+		MinScore:            fc.MinScore,
+		MinScoredBy:         fc.MinScoredBy,
+		MinMembers:          fc.MinMembers,
+		MaxRank:             fc.MaxRank,
+		MaxPopularity:       fc.MaxPopularity,
+		User:                fc.User,
+		GenresBlacklist:     fc.Blacklists.Genres,
+		TypesBlacklist:      fc.Blacklists.Types,
+		GenresWhitelist:     fc.Whitelists.Genres,
+		GenresWhitelistMode: fc.Whitelists.GenresMode,
+		Filters:             fc.Filters.Rules,
+		FiltersDefault:      fc.Filters.DefaultAction,
+		ScoreCooldown:       time.Duration(fc.CooldownDays) * 24 * time.Hour,
+		Notifiers:           notifiers,
+		Templates:           templates,
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfilesRefuseTopLevelFilters(t *testing.T) {
+	profiles := `"profiles": [{"name": "alice", "myanimelist": {"minimum_score": 7.5}, "notifiers": {"ntfy": [{"topic": "alice"}]}}]`
+	for name, tc := range map[string]struct {
+		mal     string
+		refused string
+	}{
+		"initialization only": {mal: `{"initialization": {"nb_of_seasons_to_scrape": 4}}`},
+		"filters":             {mal: `{"initialization": {}, "minimum_score": 8, "blacklists": {"genres": ["Sports"]}}`, refused: "'blacklists', 'minimum_score'"},
+	} {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(`{"myanimelist": `+tc.mal+`, `+profiles+`}`), 0o600); err != nil {
+			t.Fatalf("can't write the configuration: %v", err)
+		}
+		_, err := getConfig(path)
+		switch {
+		case tc.refused == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", name, err)
+		case tc.refused != "" && (err == nil || !strings.Contains(err.Error(), tc.refused)):
+			t.Errorf("%s: expected the %s key(s) to be refused, got: %v", name, tc.refused, err)
+		}
+	}
+}
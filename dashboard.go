@@ -0,0 +1,94 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hekmon/malradar/mal/radar"
+)
+
+const (
+	dashboardNotifications = 50
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+var dashboardTemplate = template.Must(template.New("index.html").Funcs(template.FuncMap{
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Local().Format("2006-01-02 15:04")
+	},
+	"deref": func(t *time.Time) time.Time {
+		if t == nil {
+			return time.Time{}
+		}
+		return *t
+	},
+	"join": func(values []string) string {
+		return strings.Join(values, ", ")
+	},
+	// preview and profile return nil instead of a zero value when the profile is unknown for the anime
+	"preview": func(anime radar.WatchedAnime, profile string) *radar.FilterPreview {
+		if preview, found := anime.Filters[profile]; found {
+			return &preview
+		}
+		return nil
+	},
+	"profile": func(anime radar.WatchedAnime, profile string) *radar.WatchedAnimeProfile {
+		if state, found := anime.Profiles[profile]; found {
+			return &state
+		}
+		return nil
+	},
+}).ParseFS(dashboardFiles, "dashboard/index.html"))
+
+type dashboardData struct {
+	Status        radar.Status
+	Animes        []radar.WatchedAnime
+	Notifications []radar.NotificationLog
+	Error         string
+}
+
+// dashboardStatic serves the dashboard assets
+func dashboardStatic() http.Handler {
+	static, err := fs.Sub(dashboardFiles, "dashboard/static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+}
+
+func (api *apiServer) dashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	data := dashboardData{
+		Status: watcher.Status(),
+		Animes: watcher.WatchList(),
+	}
+	// grouped by status, the most recently seen first
+	sort.SliceStable(data.Animes, func(i, j int) bool {
+		if data.Animes[i].Status != data.Animes[j].Status {
+			return data.Animes[i].Status < data.Animes[j].Status
+		}
+		return data.Animes[i].FirstSeen.After(data.Animes[j].FirstSeen)
+	})
+	var err error
+	if data.Notifications, err = watcher.RecentNotifications(dashboardNotifications); err != nil {
+		logger.Errorf("[API] can't get recent notifications: %v", err)
+		data.Error = "recent notifications are not available: " + err.Error()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err = dashboardTemplate.Execute(w, data); err != nil {
+		logger.Errorf("[API] can't render dashboard: %v", err)
+	}
+}
@@ -9,7 +9,7 @@ if [ "$0" != "./build.sh" ]; then
 fi
 
 echo "* Building alpine malradar binary"
-docker run --rm -v "$PWD/..":/usr/src/github.com/hekmon/malradar -w /usr/src/github.com/hekmon/malradar golang:1.17.0-alpine3.14 go build -v -ldflags "-s -w" -o docker/malradar_alpine
+docker run --rm -v "$PWD/..":/usr/src/github.com/hekmon/malradar -w /usr/src/github.com/hekmon/malradar golang:1.21-alpine go build -v -ldflags "-s -w" -o docker/malradar_alpine
 echo
 echo "* Building alpine container image"
 docker build -t hekmon/malradar:1.1.0 -t hekmon/malradar:latest .
@@ -7,27 +7,31 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
+	_ "time/tzdata" // schedule timezones on hosts without the tz database
 
 	"github.com/hekmon/malradar/mal/radar"
 
 	"github.com/hekmon/hllogger"
-	"github.com/hekmon/pushover/v2"
 	systemd "github.com/iguanesolutions/go-systemd"
 )
 
 var (
-	logger         *hllogger.HlLogger
-	pushoverClient *pushover.Controller
-	watcher        *radar.Controller
-	mainLock       chan struct{}
-	mainCtx        context.Context
-	mainCtxCancel  func()
+	logger        *hllogger.HlLogger
+	notifiers     []radar.Notifier
+	watcher       *radar.Controller
+	api           *apiServer
+	mainLock      chan struct{}
+	mainCtx       context.Context
+	mainCtxCancel func()
 )
 
 func main() {
 	// Parse flags
 	logLevelFlag := flag.String("loglevel", "info", "Set loglevel: debug, info, warning, error, fatal. Default info.")
 	confFile := flag.String("conf", "config.json", "Relative or absolute path to the json configuration file")
+	runNowFlag := flag.Bool("run-now", false, "Start a batch right away instead of waiting for the next scheduled one")
+	stateDirFlag := flag.String("statedir", "", "Directory where the state files are stored (overrides the state_dir configuration value). Default current working directory.")
 	flag.Parse()
 
 	// Init logger
@@ -66,32 +70,76 @@ func main() {
 		logger.Fatalf(1, "[Main] configuration extraction failed: %v", err)
 	}
 
-	// Init the pushover client
-	pushoverClient = pushover.New(&conf.Pushover.ApplicationKey, &conf.Pushover.UserKey)
+	if *stateDirFlag != "" {
+		conf.StateDir = *stateDirFlag
+	}
+
+	// Init the notifiers
+	topNotifiers, err := radar.NewNotifiers(conf.Notifiers)
+	if err != nil {
+		logger.Fatalf(1, "[Main] notifiers initialization failed: %v", err)
+	}
+	notifiers = append(notifiers, topNotifiers...)
+
+	// Load the notifications templates
+	templates, err := radar.LoadTemplates(conf.Templates)
+	if err != nil {
+		logger.Fatalf(1, "[Main] notifications templates loading failed: %v", err)
+	}
+
+	// Prepare the watch profiles
+	var profiles []radar.ProfileConfig
+	if len(conf.Profiles) == 0 {
+		profiles = append(profiles, conf.MAL.profileConfig(radar.DefaultProfile, topNotifiers, templates))
+	} else {
+		for _, profile := range conf.Profiles {
+			profileNotifiers, err := radar.NewNotifiers(profile.Notifiers)
+			if err != nil {
+				logger.Fatalf(1, "[Main] profile '%s': notifiers initialization failed: %v", profile.Name, err)
+			}
+			notifiers = append(notifiers, profileNotifiers...)
+			// profiles without their own templates use the top level ones
+			profileTemplates := templates
+			if profile.Templates != (radar.TemplatesConfig{}) {
+				if profileTemplates, err = radar.LoadTemplates(profile.Templates); err != nil {
+					logger.Fatalf(1, "[Main] profile '%s': notifications templates loading failed: %v", profile.Name, err)
+				}
+			}
+			profiles = append(profiles, profile.MAL.profileConfig(profile.Name, profileNotifiers, profileTemplates))
+		}
+	}
 
 	// Init the mal watcher core
 	mainCtx, mainCtxCancel = context.WithCancel(context.Background())
 	defer mainCtxCancel()
 	watcher = radar.New(mainCtx, radar.Config{
+		StateDir:        conf.StateDir,
 		NbSeasons:       conf.MAL.Init.NbSeasons,
 		NotifyInit:      conf.MAL.Init.Notify,
-		MinScore:        conf.MAL.MinScore,
-		User:            conf.MAL.User,
-		GenresBlacklist: conf.MAL.Blacklists.Genres,
-		TypesBlacklist:  conf.MAL.Blacklists.Types,
-		Pushover:        pushoverClient,
+		InitErrorPolicy: conf.MAL.Init.OnError,
+		RunNow:          *runNowFlag,
+		RateLimit:       conf.RateLimit,
+		Schedule:        conf.Schedule,
+		Source:          conf.Source,
+		Storage:         conf.Storage,
+		Profiles:        profiles,
 		Logger:          logger,
 	})
 	if watcher == nil {
 		logger.Fatal(1, "[Main] Failted to instanciate the watcher")
 	}
 
+	// Start the status & control API if enabled
+	api = startAPI(conf.API)
+
 	// Prepare to handle signals
 	mainLock = make(chan struct{})
 	go handleSignals()
 
 	// We are ready (tell the world and go to sleep)
-	pushoverClient.SendNormalPriorityMsg("(づ ◕‿◕ )づ 📡\nkeeping my eyes on the radar~", "")
+	broadcast(radar.Notification{
+		Message: "(づ ◕‿◕ )づ 📡\nkeeping my eyes on the radar~",
+	})
 	if err = systemd.NotifyReady(); err != nil {
 		logger.Errorf("[Main] can't send systemd ready notification: %v", err)
 	}
@@ -106,7 +154,7 @@ func handleSignals() {
 	// If we exit, allow main goroutine to do so
 	defer close(mainLock)
 	// Register signals
-	signalChannel := make(chan os.Signal)
+	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
 	// Waiting for signals to catch
 	for {
@@ -129,8 +177,12 @@ func handleSignals() {
 			if err = systemd.NotifyStopping(); err != nil {
 				logger.Errorf("[Main] can't send systemd stopping notification: %v", err)
 			}
-			pushoverClient.SendHighPriorityMsg("(╯︵╰,) Radar offline !", "")
-			// Cancel main ctx & wait for watcher
+			broadcast(radar.Notification{
+				Message:      "(╯︵╰,) Radar offline !",
+				HighPriority: true,
+			})
+			// Stop the API, cancel main ctx & wait for watcher
+			api.stop()
 			mainCtxCancel()
 			watcher.WaitStopped()
 			logger.Debugf("[Main] Signal '%v' caught: watcher stopped: unlocking main goroutine to exit", sig)
@@ -140,3 +192,12 @@ func handleSignals() {
 		}
 	}
 }
+
+func broadcast(notif radar.Notification) {
+	notif.Timestamp = time.Now()
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(mainCtx, notif); err != nil {
+			logger.Errorf("[Main] can't send '%s' message thru %s: %v", notif.Message, notifier.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package radar
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	statsMyAnimeList = "MyAnimeList"
+	statsAniList     = "AniList"
+)
+
+// Anime holds the details of an anime as provided by an AnimeSource
+type Anime struct {
+	MalID int
+	URL   string
+	// ImageURL is the URL of the largest cover available (can be empty)
+	ImageURL      string
+	Title         string
+	TitleEnglish  string
+	TitleJapanese string
+	TitleSynonyms []string
+	Type          string
+	Source        string
+	Episodes      int
+	Status        string
+	Aired         Aired
+	Duration      string
+	Rating        string
+	// StatsSource is the site Score, ScoredBy, Rank, Popularity and Members come from: MyAnimeList or AniList
+	StatsSource string
+	Score       float64
+	// AniListScore is the AniList average score (out of 100), 0 if unknown
+	AniListScore float64
+	ScoredBy     int
+	Rank         int
+	Popularity   int
+	Members      int
+	Favorites    int
+	Synopsis     string
+	Background   string
+	Premiered    string
+	TrailerURL   string
+	// Genres contains all the genres, themes and demographics included
+	Genres       []string
+	Themes       []string
+	Demographics []string
+	Studios      []string
+	Producers    []string
+	Licensors    []string
+}
+
+// Aired contains the airing dates of an anime, zero if unknown
+type Aired struct {
+	From time.Time
+	To   time.Time
+}
+
+// AnimeSource provides the animes of a season and their details
+type AnimeSource interface {
+	// Name returns a short identifier of the source, used in logs
+	Name() string
+	// Season returns the animes of a season. Their details may be partial: use Anime to get all of them.
+	Season(ctx context.Context, year int, season string) ([]*Anime, error)
+	// Anime returns the details of an anime. The error must match ErrNotFound (using errors.Is)
+	// if the anime does not exist.
+	Anime(ctx context.Context, malID int) (*Anime, error)
+}
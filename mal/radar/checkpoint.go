@@ -0,0 +1,115 @@
+package radar
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	checkpointFile = "initial_build_checkpoint.json"
+	// checkpointInterval is the number of processed animes between two checkpoints within a season
+	checkpointInterval = 25
+	// checkpointVersion is the current version of the checkpoint schema
+	checkpointVersion = 1
+)
+
+const (
+	// InitErrorSkip leaves out an anime whose details can't be fetched during the initial list building
+	InitErrorSkip = "skip"
+	// InitErrorAbort stops the initial list building when an anime details can't be fetched,
+	// it will be resumed from the last checkpoint at the next batch
+	InitErrorAbort = "abort"
+)
+
+// buildCheckpoint is the progress of the initial list building
+type buildCheckpoint struct {
+	Version int `json:"version"`
+	// StartYear and StartSeason are the current season when the building started
+	StartYear   int    `json:"start_year"`
+	StartSeason string `json:"start_season"`
+	// Season is the index of the season in progress and Index the next anime to process within it
+	Season    int                 `json:"season"`
+	Index     int                 `json:"index"`
+	Animes    map[int]*animeState `json:"animes"`
+	Skipped   map[int]string      `json:"skipped,omitempty"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+func newBuildCheckpoint() *buildCheckpoint {
+	year, season := currentSeason()
+	return &buildCheckpoint{
+		Version:     checkpointVersion,
+		StartYear:   year,
+		StartSeason: season,
+		Animes:      make(map[int]*animeState),
+		Skipped:     make(map[int]string),
+	}
+}
+
+// season returns the year and season name of the season at index
+func (bc *buildCheckpoint) season(index int) (year int, season string) {
+	year, season = bc.StartYear, bc.StartSeason
+	for i := 0; i < index; i++ {
+		year, season = previousSeason(season, year)
+	}
+	return
+}
+
+// validate checks a loaded checkpoint can be used to resume the building
+func (bc *buildCheckpoint) validate() error {
+	if bc.Version != checkpointVersion {
+		return fmt.Errorf("unsupported checkpoint version %d (current version is %d)", bc.Version, checkpointVersion)
+	}
+	switch bc.StartSeason {
+	case winter, spring, summer, fall:
+	default:
+		return fmt.Errorf("invalid start season '%s'", bc.StartSeason)
+	}
+	if bc.Season < 0 || bc.Index < 0 {
+		return fmt.Errorf("invalid position: season %d index %d", bc.Season, bc.Index)
+	}
+	if bc.Animes == nil {
+		bc.Animes = make(map[int]*animeState)
+	}
+	if bc.Skipped == nil {
+		bc.Skipped = make(map[int]string)
+	}
+	return nil
+}
+
+// resumeCheckpoint returns the checkpoint of a previous initial list building or a fresh one
+func (c *Controller) resumeCheckpoint() (checkpoint *buildCheckpoint) {
+	checkpoint, err := c.store.loadCheckpoint()
+	if err == nil && checkpoint != nil {
+		err = checkpoint.validate()
+	}
+	switch {
+	case err != nil:
+		c.log.Errorf("[MAL] [Watcher] building initial list: can't use previous checkpoint, starting over: %v", err)
+	case checkpoint == nil:
+		c.log.Debug("[MAL] [Watcher] building initial list: no checkpoint found")
+	default:
+		year, season := checkpoint.season(checkpoint.Season)
+		c.log.Infof("[MAL] [Watcher] building initial list: resuming from checkpoint of %v: season %d/%d (%s %d) anime %d, %d anime(s) already tracked",
+			checkpoint.UpdatedAt.Format(time.RFC1123), checkpoint.Season+1, c.nbSeasons, season, year, checkpoint.Index+1, len(checkpoint.Animes))
+		return
+	}
+	return newBuildCheckpoint()
+}
+
+// checkpoint persists the progress of the initial list building.
+// The next anime to process is the one at index within the season at seasonIndex.
+func (c *Controller) checkpoint(checkpoint *buildCheckpoint, seasonIndex, index int) {
+	c.update.Lock()
+	defer c.update.Unlock()
+	checkpoint.Season = seasonIndex
+	checkpoint.Index = index
+	checkpoint.Animes = c.watchList
+	checkpoint.UpdatedAt = time.Now()
+	if err := c.store.saveCheckpoint(checkpoint); err != nil {
+		c.log.Errorf("[MAL] [Watcher] building initial list: can't save checkpoint: %v", err)
+		return
+	}
+	c.log.Debugf("[MAL] [Watcher] building initial list: checkpoint saved at season %d anime %d (%d anime(s) tracked)",
+		seasonIndex+1, index+1, len(c.watchList))
+}
@@ -2,12 +2,12 @@ package radar
 
 import (
 	"context"
-	"strings"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/hekmon/hllogger"
-	"github.com/hekmon/pushover/v2"
+	"github.com/hekmon/malradar/mal/userlist"
 )
 
 const (
@@ -17,21 +17,25 @@ const (
 
 // Config allow to pass configuration when instanciating a new Controller
 type Config struct {
+	StateDir        string
 	NbSeasons       int
 	NotifyInit      bool
-	MinScore        float64
-	User            string
-	GenresBlacklist []string
-	TypesBlacklist  []string
-	Pushover        *pushover.Controller
-	Logger          *hllogger.HlLogger
+	InitErrorPolicy string
+	RateLimit       RateLimitConfig
+	// RunNow starts a batch right away instead of waiting for the scheduled one
+	RunNow   bool
+	Schedule ScheduleConfig
+	Storage  StorageConfig
+	Profiles []ProfileConfig
+	Source   SourceConfig
+	Logger   *hllogger.HlLogger
 }
 
 // New returns an initialized & ready to use controller
 func New(ctx context.Context, conf Config) (c *Controller) {
 	// config checks
-	if conf.Logger == nil {
-		panic("can't init mal controller with a nil pushover")
+	if len(conf.Profiles) == 0 {
+		panic("can't init mal controller without profiles")
 	}
 	if conf.Logger == nil {
 		panic("can't init mal controller with a nil logger")
@@ -45,43 +49,103 @@ func New(ctx context.Context, conf Config) (c *Controller) {
 			nbSeaonsMax, conf.NbSeasons, nbSeaonsMax)
 		conf.NbSeasons = nbSeaonsMax
 	}
+	switch conf.InitErrorPolicy {
+	case "":
+		conf.InitErrorPolicy = InitErrorSkip
+	case InitErrorSkip, InitErrorAbort:
+	default:
+		conf.Logger.Errorf("[MAL] invalid initial list building error policy '%s' (valid values are '%s' and '%s')",
+			conf.InitErrorPolicy, InitErrorSkip, InitErrorAbort)
+		return
+	}
+	if conf.StateDir == "" {
+		conf.StateDir = "."
+	}
+	if err := checkStateDir(conf.StateDir); err != nil {
+		conf.Logger.Errorf("[MAL] invalid state directory '%s': %v", conf.StateDir, err)
+		return
+	}
+	profiles := make([]*profile, len(conf.Profiles))
+	names := make(map[string]bool, len(conf.Profiles))
+	for index, profileConf := range conf.Profiles {
+		if names[profileConf.Name] {
+			conf.Logger.Errorf("[MAL] profile name '%s' is used more than once", profileConf.Name)
+			return
+		}
+		names[profileConf.Name] = true
+		var err error
+		if profiles[index], err = newProfile(profileConf); err != nil {
+			conf.Logger.Errorf("[MAL] invalid profile #%d: %v", index+1, err)
+			return
+		}
+	}
+	schedule, err := newSchedule(conf.Schedule)
+	if err != nil {
+		conf.Logger.Errorf("[MAL] invalid batch schedule: %v", err)
+		return
+	}
+	metrics := newMetrics()
+	limiter, err := newRateLimiter(ctx, conf.RateLimit, metrics, conf.Logger)
+	if err != nil {
+		conf.Logger.Errorf("[MAL] invalid rate limit configuration: %v", err)
+		return
+	}
+	// every MAL and Jikan requests share the same rate limiter
+	source, err := newSource(conf.Source, limiter, metrics, conf.Logger)
+	if err != nil {
+		conf.Logger.Errorf("[MAL] invalid source configuration: %v", err)
+		return
+	}
+	conf.Logger.Infof("[MAL] using '%s' as state directory", conf.StateDir)
+	store, err := newStore(conf.Storage, conf.StateDir, conf.Logger)
+	if err != nil {
+		conf.Logger.Errorf("[MAL] invalid storage configuration: %v", err)
+		return
+	}
 	// create the controller
 	c = &Controller{
 		// init
-		nbSeasons:  conf.NbSeasons,
-		notifyInit: conf.NotifyInit,
+		nbSeasons:       conf.NbSeasons,
+		notifyInit:      conf.NotifyInit,
+		initErrorPolicy: conf.InitErrorPolicy,
 		// config
 		ctx:      ctx,
-		minScore: conf.MinScore,
-		user:     conf.User,
-		blGenres: conf.GenresBlacklist,
-		blTypes:  conf.TypesBlacklist,
+		stateDir: conf.StateDir,
+		runNow:   conf.RunNow,
+		profiles: profiles,
+		schedule: schedule,
+		source:   source,
 		// worker control
+		trigger: make(chan bool, 1),
 		stopped: make(chan struct{}),
 		// sub controllers
-		pushover: conf.Pushover,
-		log:      conf.Logger,
+		store:      store,
+		httpClient: newLimitedClient(limiter),
+		metrics:    metrics,
+		log:        conf.Logger,
 	}
-	if len(c.blGenres) == 0 {
-		c.log.Infof("[MAL] controller instanciated with minimum score at %.2f and no blacklisted genre",
-			c.minScore)
-	} else {
-		c.log.Infof("[MAL] controller instanciated with minimum score at %.2f and the following genre(s) blacklisted: %s",
-			c.minScore, strings.Join(c.blGenres, ", "))
+	userlist.Client = c.httpClient
+	c.log.Infof("[MAL] controller instanciated with %d profile(s), batches scheduled with %s", len(c.profiles), c.schedule)
+	c.log.Infof("[MAL] animes details provided by %s", c.source.Name())
+	c.log.Infof("[MAL] requests limited to %s", limiter)
+	for _, p := range c.profiles {
+		c.log.Infof("[MAL] profile '%s': %d notifier(s), %d filter rule(s) and '%s' as default filter action",
+			p.name, len(p.notifiers), len(p.filters.rules), p.filters.defaultAction)
+		for index, rule := range p.filters.rules {
+			c.log.Debugf("[MAL] profile '%s': filter rule %d/%d: '%s' (%s)", p.name, index+1, len(p.filters.rules), rule.Name, rule.Action)
+		}
 	}
 	// recover previous state if any
-	if !c.load(stateFile) {
+	if !c.load() {
+		store.close()
 		c = nil
 		return
 	}
-	c.load(genresFile)
-	c.load(ratingsFile)
-	c.load(typesFile)
 	// start the worker(s)
 	c.workers.Add(1)
 	go func() {
-		go c.watcher()
-		c.workers.Done()
+		defer c.workers.Done()
+		c.watcher()
 	}()
 	// Create the auto-stopper (must be launch after the worker(s) in case ctx is cancelled while launching workers)
 	go c.autostop()
@@ -92,27 +156,37 @@ func New(ctx context.Context, conf Config) (c *Controller) {
 // Controller abstract all the logic of the MAL watcher
 type Controller struct {
 	// init
-	nbSeasons  int
-	notifyInit bool
+	nbSeasons       int
+	notifyInit      bool
+	initErrorPolicy string
 	// config
 	ctx      context.Context
-	minScore float64
-	user     string
-	blGenres []string
-	blTypes  []string
+	stateDir string
+	runNow   bool
+	profiles []*profile
+	schedule *schedule
+	source   AnimeSource
 	// state
 	update    sync.Mutex
-	watchList map[int]string
+	watchList map[int]*animeState
 	genres    UniqList
 	ratings   UniqList
 	types     UniqList
 	// worker(s)
-	workers     sync.WaitGroup
-	stopped     chan struct{}
-	lastRequest time.Time
+	workers sync.WaitGroup
+	trigger chan bool // true for a rebuild
+	stopped chan struct{}
+	// activity
+	activity     sync.Mutex
+	runningSince time.Time
+	lastBatch    *BatchResult
+	lastSuccess  time.Time
+	nextBatch    time.Time
 	// sub controllers
-	pushover *pushover.Controller
-	log      *hllogger.HlLogger
+	store      store
+	httpClient *http.Client
+	metrics    *metrics
+	log        *hllogger.HlLogger
 }
 
 func (c *Controller) autostop() {
@@ -121,10 +195,10 @@ func (c *Controller) autostop() {
 	// Begin the stopping proceedure
 	c.workers.Wait()
 	// save state
-	c.save(stateFile)
-	c.save(genresFile)
-	c.save(ratingsFile)
-	c.save(typesFile)
+	c.saveState()
+	if err := c.store.close(); err != nil {
+		c.log.Errorf("[MAL] [Store] can't close the %s backend: %v", c.store.name(), err)
+	}
 	// Close the stopped chan to indicate we are fully stopped
 	close(c.stopped)
 }
@@ -136,12 +210,9 @@ func (c *Controller) WaitStopped() {
 	<-c.stopped
 }
 
-// SaveStateNow permits to save/dump current state to files without stopping the controller
+// SaveStateNow permits to save/dump current state to the storage backend without stopping the controller
 func (c *Controller) SaveStateNow() {
 	c.update.Lock()
-	c.save(stateFile)
-	c.save(genresFile)
-	c.save(ratingsFile)
-	c.save(typesFile)
+	c.saveState()
 	c.update.Unlock()
 }
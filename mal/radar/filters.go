@@ -0,0 +1,461 @@
+package radar
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FilterAction defines what happens when a filter rule is evaluated
+type FilterAction string
+
+const (
+	// FilterAllow stops the evaluation and notifies the anime if the rule matches
+	FilterAllow FilterAction = "allow"
+	// FilterDeny stops the evaluation and discards the anime if the rule matches
+	FilterDeny FilterAction = "deny"
+	// FilterRequire discards the anime if the rule does not match, evaluation continues otherwise
+	FilterRequire FilterAction = "require"
+)
+
+const (
+	// GenresModeAny requires an anime to have at least one of the whitelisted genres
+	GenresModeAny = "any"
+	// GenresModeAll requires an anime to have all of the whitelisted genres
+	GenresModeAll = "all"
+)
+
+var (
+	durationHoursRegex   = regexp.MustCompile(`([0-9]+) hr`)
+	durationMinutesRegex = regexp.MustCompile(`([0-9]+) min`)
+	durationSecondsRegex = regexp.MustCompile(`([0-9]+) sec`)
+)
+
+// FilterRule is a single rule of the filters chain
+type FilterRule struct {
+	Name   string        `json:"name"`
+	Action FilterAction  `json:"action"`
+	Match  FilterMatcher `json:"match"`
+}
+
+// FilterMatcher matches an anime if all of its set criteria match
+type FilterMatcher struct {
+	Types        []string      `json:"types"`
+	Genres       *ListMatcher  `json:"genres"`
+	Themes       *ListMatcher  `json:"themes"`
+	Demographics *ListMatcher  `json:"demographics"`
+	Studios      *ListMatcher  `json:"studios"`
+	Sources      []string      `json:"sources"`
+	Ratings      []string      `json:"ratings"`
+	Episodes     *RangeMatcher `json:"episodes"`
+	Duration     *RangeMatcher `json:"duration"` // minutes per episode
+	Year         *RangeMatcher `json:"year"`
+	Score        *RangeMatcher `json:"score"`
+	AniListScore *RangeMatcher `json:"anilist_score"` // out of 100
+	ScoredBy     *RangeMatcher `json:"scored_by"`
+	Rank         *RangeMatcher `json:"rank"`
+	Popularity   *RangeMatcher `json:"popularity"`
+	Members      *RangeMatcher `json:"members"`
+}
+
+// ListMatcher matches a list of values (genres for example) if it contains any or all of the configured values.
+// In JSON it can be a plain array (any mode) or an object with the "any" and/or "all" keys.
+type ListMatcher struct {
+	Any []string `json:"any"`
+	All []string `json:"all"`
+}
+
+// UnmarshalJSON allows a ListMatcher to be declared as a plain JSON array
+func (lm *ListMatcher) UnmarshalJSON(data []byte) (err error) {
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		return json.Unmarshal(data, &lm.Any)
+	}
+	type alias ListMatcher
+	return json.Unmarshal(data, (*alias)(lm))
+}
+
+// RangeMatcher matches a numeric value within the inclusive [Min, Max] range. Unset bounds are ignored.
+type RangeMatcher struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// legacyFilterRules converts the historical blacklists, whitelists and thresholds to filter rules
+func legacyFilterRules(conf ProfileConfig) (rules []FilterRule, err error) {
+	if len(conf.TypesBlacklist) > 0 {
+		rules = append(rules, FilterRule{
+			Name:   "types blacklist",
+			Action: FilterDeny,
+			Match: FilterMatcher{
+				Types: conf.TypesBlacklist,
+			},
+		})
+	}
+	if len(conf.GenresBlacklist) > 0 {
+		rules = append(rules, FilterRule{
+			Name:   "genres blacklist",
+			Action: FilterDeny,
+			Match: FilterMatcher{
+				Genres: &ListMatcher{Any: conf.GenresBlacklist},
+			},
+		})
+	}
+	if len(conf.GenresWhitelist) > 0 {
+		var matcher ListMatcher
+		switch conf.GenresWhitelistMode {
+		case "", GenresModeAny:
+			matcher.Any = conf.GenresWhitelist
+		case GenresModeAll:
+			matcher.All = conf.GenresWhitelist
+		default:
+			err = fmt.Errorf("invalid genres whitelist mode '%s': must be '%s' or '%s'",
+				conf.GenresWhitelistMode, GenresModeAny, GenresModeAll)
+			return
+		}
+		rules = append(rules, FilterRule{
+			Name:   "genres whitelist",
+			Action: FilterRequire,
+			Match: FilterMatcher{
+				Genres: &matcher,
+			},
+		})
+	}
+	if conf.MinScore > 0 {
+		minScore := conf.MinScore
+		rules = append(rules, FilterRule{
+			Name:   "minimum score",
+			Action: FilterRequire,
+			Match: FilterMatcher{
+				Score: &RangeMatcher{Min: &minScore},
+			},
+		})
+	}
+	if conf.MinScoredBy > 0 {
+		minScoredBy := float64(conf.MinScoredBy)
+		rules = append(rules, FilterRule{
+			Name:   "minimum votes",
+			Action: FilterRequire,
+			Match: FilterMatcher{
+				ScoredBy: &RangeMatcher{Min: &minScoredBy},
+			},
+		})
+	}
+	if conf.MinMembers > 0 {
+		minMembers := float64(conf.MinMembers)
+		rules = append(rules, FilterRule{
+			Name:   "minimum members",
+			Action: FilterRequire,
+			Match: FilterMatcher{
+				Members: &RangeMatcher{Min: &minMembers},
+			},
+		})
+	}
+	if conf.MaxRank > 0 {
+		maxRank := float64(conf.MaxRank)
+		rules = append(rules, FilterRule{
+			Name:   "maximum rank",
+			Action: FilterRequire,
+			Match: FilterMatcher{
+				Rank: &RangeMatcher{Max: &maxRank},
+			},
+		})
+	}
+	if conf.MaxPopularity > 0 {
+		maxPopularity := float64(conf.MaxPopularity)
+		rules = append(rules, FilterRule{
+			Name:   "maximum popularity",
+			Action: FilterRequire,
+			Match: FilterMatcher{
+				Popularity: &RangeMatcher{Max: &maxPopularity},
+			},
+		})
+	}
+	return
+}
+
+type filterDecision struct {
+	notify  bool
+	rule    string
+	reasons []string
+	// volatile indicates a negative decision based on statistics (score, votes, etc...) which may still evolve
+	volatile bool
+}
+
+type filters struct {
+	rules         []FilterRule
+	defaultAction FilterAction
+}
+
+func newFilters(rules []FilterRule, defaultAction FilterAction) (f *filters, err error) {
+	if defaultAction == "" {
+		defaultAction = FilterAllow
+	}
+	if defaultAction != FilterAllow && defaultAction != FilterDeny {
+		err = fmt.Errorf("invalid default filter action '%s': must be '%s' or '%s'", defaultAction, FilterAllow, FilterDeny)
+		return
+	}
+	f = &filters{
+		rules:         make([]FilterRule, len(rules)),
+		defaultAction: defaultAction,
+	}
+	for index, rule := range rules {
+		switch rule.Action {
+		case FilterAllow, FilterDeny, FilterRequire:
+		default:
+			err = fmt.Errorf("rule #%d: invalid action '%s': must be '%s', '%s' or '%s'",
+				index+1, rule.Action, FilterAllow, FilterDeny, FilterRequire)
+			return
+		}
+		if err = rule.Match.validate(); err != nil {
+			err = fmt.Errorf("rule #%d: %w", index+1, err)
+			return
+		}
+		if rule.Match.isEmpty() {
+			err = fmt.Errorf("rule #%d: at least one match criteria must be set", index+1)
+			return
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule #%d", index+1)
+		}
+		f.rules[index] = rule
+	}
+	return
+}
+
+// evaluate runs anime thru the rules chain. The decision reasons contain the rules which made it.
+func (f *filters) evaluate(anime *Anime) (decision filterDecision) {
+	var statsAllowRule bool
+	for _, rule := range f.rules {
+		matched, statsFailure, details := rule.Match.match(anime)
+		switch rule.Action {
+		case FilterAllow:
+			if matched {
+				decision.notify = true
+				decision.rule = rule.Name
+				decision.reasons = append(decision.reasons, fmt.Sprintf("allowed by '%s' (%s)", rule.Name, details))
+				return
+			}
+			statsAllowRule = statsAllowRule || rule.Match.usesStats()
+		case FilterDeny:
+			if matched {
+				decision.rule = rule.Name
+				decision.reasons = []string{fmt.Sprintf("denied by '%s' (%s)", rule.Name, details)}
+				decision.volatile = rule.Match.usesStats()
+				return
+			}
+		case FilterRequire:
+			if !matched {
+				decision.rule = rule.Name
+				decision.reasons = []string{fmt.Sprintf("requirement '%s' not met (%s)", rule.Name, details)}
+				decision.volatile = statsFailure
+				return
+			}
+			decision.reasons = append(decision.reasons, fmt.Sprintf("requirement '%s' met (%s)", rule.Name, details))
+		}
+	}
+	decision.rule = "default"
+	if f.defaultAction == FilterDeny {
+		decision.reasons = []string{"denied by default action"}
+		decision.volatile = statsAllowRule
+		return
+	}
+	decision.notify = true
+	decision.reasons = append(decision.reasons, "allowed by default action")
+	return
+}
+
+func (fm FilterMatcher) isEmpty() bool {
+	return len(fm.Types) == 0 && fm.Genres == nil && fm.Themes == nil && fm.Demographics == nil &&
+		fm.Studios == nil && len(fm.Sources) == 0 && len(fm.Ratings) == 0 && fm.Episodes == nil &&
+		fm.Duration == nil && fm.Year == nil && fm.Score == nil && fm.AniListScore == nil && fm.ScoredBy == nil &&
+		fm.Rank == nil && fm.Popularity == nil && fm.Members == nil
+}
+
+// validate rejects the lists set but empty: an empty list would never match (or always for an empty "all")
+func (fm FilterMatcher) validate() error {
+	for field, values := range map[string][]string{
+		"types":   fm.Types,
+		"sources": fm.Sources,
+		"ratings": fm.Ratings,
+	} {
+		if values != nil && len(values) == 0 {
+			return fmt.Errorf("'%s' list can't be empty", field)
+		}
+	}
+	for field, matcher := range map[string]*ListMatcher{
+		"genres":       fm.Genres,
+		"themes":       fm.Themes,
+		"demographics": fm.Demographics,
+		"studios":      fm.Studios,
+	} {
+		if matcher != nil && len(matcher.Any) == 0 && len(matcher.All) == 0 {
+			return fmt.Errorf("'%s' list can't be empty", field)
+		}
+	}
+	return nil
+}
+
+// usesStats returns true if the matcher relies on statistics which evolve over time
+func (fm FilterMatcher) usesStats() bool {
+	return fm.Score != nil || fm.AniListScore != nil || fm.ScoredBy != nil || fm.Rank != nil || fm.Popularity != nil ||
+		fm.Members != nil
+}
+
+// match returns true if all the set criteria match. details describes the matching criteria
+// or the first one that did not match, statsFailure indicates if this one is a statistics criteria.
+func (fm FilterMatcher) match(anime *Anime) (matched, statsFailure bool, details string) {
+	matches := make([]string, 0, 2)
+	check := func(ok bool, description string) bool {
+		if !ok {
+			details = description
+			return false
+		}
+		matches = append(matches, description)
+		return true
+	}
+	if len(fm.Types) > 0 && !check(matchOneOf(fm.Types, anime.Type, "type")) {
+		return
+	}
+	if fm.Genres != nil && !check(fm.Genres.match(anime.Genres, "genres")) {
+		return
+	}
+	if fm.Themes != nil && !check(fm.Themes.match(anime.Themes, "themes")) {
+		return
+	}
+	if fm.Demographics != nil && !check(fm.Demographics.match(anime.Demographics, "demographics")) {
+		return
+	}
+	if fm.Studios != nil && !check(fm.Studios.match(anime.Studios, "studios")) {
+		return
+	}
+	if len(fm.Sources) > 0 && !check(matchOneOf(fm.Sources, anime.Source, "source")) {
+		return
+	}
+	if len(fm.Ratings) > 0 && !check(matchOneOf(fm.Ratings, anime.Rating, "rating")) {
+		return
+	}
+	if fm.Episodes != nil && !check(fm.Episodes.match(float64(anime.Episodes), anime.Episodes != 0, "episodes")) {
+		return
+	}
+	if fm.Duration != nil {
+		duration := parseDuration(anime.Duration)
+		if !check(fm.Duration.match(duration, duration != 0, "duration")) {
+			return
+		}
+	}
+	if fm.Year != nil && !check(fm.Year.match(float64(anime.Aired.From.Year()), !anime.Aired.From.IsZero(), "year")) {
+		return
+	}
+	// AniList does not provide the votes: its score (brought back to the MyAnimeList scale) is known if the anime has one
+	malStats := anime.StatsSource != statsAniList
+	if fm.Score != nil && !check(fm.Score.match(anime.Score, malStats || anime.Score != 0, "score")) {
+		statsFailure = true
+		return
+	}
+	if fm.AniListScore != nil && !check(fm.AniListScore.match(anime.AniListScore, anime.AniListScore != 0, "anilist score")) {
+		statsFailure = true
+		return
+	}
+	if fm.ScoredBy != nil && !check(fm.ScoredBy.match(float64(anime.ScoredBy), malStats, "scored by")) {
+		statsFailure = true
+		return
+	}
+	if fm.Rank != nil && !check(fm.Rank.match(float64(anime.Rank), anime.Rank != 0, "rank")) {
+		statsFailure = true
+		return
+	}
+	if fm.Popularity != nil && !check(fm.Popularity.match(float64(anime.Popularity), anime.Popularity != 0, "popularity")) {
+		statsFailure = true
+		return
+	}
+	if fm.Members != nil && !check(fm.Members.match(float64(anime.Members), true, "members")) {
+		statsFailure = true
+		return
+	}
+	return true, false, strings.Join(matches, ", ")
+}
+
+func (lm *ListMatcher) match(values []string, field string) (matched bool, description string) {
+	present := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		present[value] = struct{}{}
+	}
+	// all
+	for _, wanted := range lm.All {
+		if _, found := present[wanted]; !found {
+			return false, fmt.Sprintf("%s do not contain '%s'", field, wanted)
+		}
+	}
+	// any
+	if len(lm.Any) == 0 {
+		return true, fmt.Sprintf("%s contain all of %s", field, strings.Join(lm.All, ", "))
+	}
+	found := make([]string, 0, len(lm.Any))
+	for _, wanted := range lm.Any {
+		if _, ok := present[wanted]; ok {
+			found = append(found, wanted)
+		}
+	}
+	if len(found) == 0 {
+		return false, fmt.Sprintf("%s do not contain any of %s", field, strings.Join(lm.Any, ", "))
+	}
+	return true, fmt.Sprintf("%s contain %s", field, strings.Join(found, ", "))
+}
+
+func (rm *RangeMatcher) match(value float64, known bool, field string) (matched bool, description string) {
+	if !known {
+		return false, fmt.Sprintf("%s is unknown", field)
+	}
+	min, max := math.Inf(-1), math.Inf(1)
+	if rm.Min != nil {
+		min = *rm.Min
+	}
+	if rm.Max != nil {
+		max = *rm.Max
+	}
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+	if value < min || value > max {
+		return false, fmt.Sprintf("%s %s is not within %s", field, formatted, rm)
+	}
+	return true, fmt.Sprintf("%s %s is within %s", field, formatted, rm)
+}
+
+func (rm *RangeMatcher) String() string {
+	min, max := "-∞", "+∞"
+	if rm.Min != nil {
+		min = strconv.FormatFloat(*rm.Min, 'f', -1, 64)
+	}
+	if rm.Max != nil {
+		max = strconv.FormatFloat(*rm.Max, 'f', -1, 64)
+	}
+	return fmt.Sprintf("[%s, %s]", min, max)
+}
+
+func matchOneOf(candidates []string, value, field string) (matched bool, description string) {
+	for _, candidate := range candidates {
+		if value == candidate {
+			return true, fmt.Sprintf("%s is '%s'", field, value)
+		}
+	}
+	return false, fmt.Sprintf("%s '%s' is not one of %s", field, value, strings.Join(candidates, ", "))
+}
+
+// parseDuration converts a MyAnimeList duration ("1 hr 30 min", "24 min per ep", etc...) to minutes
+func parseDuration(duration string) (minutes float64) {
+	if match := durationHoursRegex.FindStringSubmatch(duration); match != nil {
+		hours, _ := strconv.Atoi(match[1])
+		minutes += float64(hours * 60)
+	}
+	if match := durationMinutesRegex.FindStringSubmatch(duration); match != nil {
+		mins, _ := strconv.Atoi(match[1])
+		minutes += float64(mins)
+	}
+	if match := durationSecondsRegex.FindStringSubmatch(duration); match != nil {
+		seconds, _ := strconv.Atoi(match[1])
+		minutes += float64(seconds) / 60
+	}
+	return
+}
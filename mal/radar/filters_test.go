@@ -0,0 +1,96 @@
+package radar
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewFiltersRejectsEmptyLists(t *testing.T) {
+	for _, match := range []string{
+		`{"genres": []}`,
+		`{"studios": {"any": [], "all": []}}`,
+		`{"types": [], "genres": ["Action"]}`,
+		`{"ratings": []}`,
+	} {
+		var rule FilterRule
+		if err := json.Unmarshal([]byte(`{"action": "deny", "match": `+match+`}`), &rule); err != nil {
+			t.Fatalf("can't decode %s: %v", match, err)
+		}
+		if _, err := newFilters([]FilterRule{rule}, FilterAllow); err == nil || !strings.Contains(err.Error(), "can't be empty") {
+			t.Errorf("%s: expected an empty list error, got: %v", match, err)
+		}
+	}
+}
+
+func TestProfileUserRulesBeforeLegacyRules(t *testing.T) {
+	p, err := newProfile(ProfileConfig{
+		Name:            DefaultProfile,
+		GenresBlacklist: []string{"Sports"},
+		Filters: []FilterRule{{
+			Action: FilterAllow,
+			Match:  FilterMatcher{Studios: &ListMatcher{Any: []string{"Production I.G"}}},
+		}},
+		Notifiers: []Notifier{&WebhookNotifier{name: "webhook"}},
+	})
+	if err != nil {
+		t.Fatalf("can't create profile: %v", err)
+	}
+	decision := p.filters.evaluate(&Anime{Genres: []string{"Sports"}, Studios: []string{"Production I.G"}})
+	if !decision.notify || decision.rule != "rule #1" {
+		t.Errorf("the user allow rule should override the legacy blacklist: %+v", decision)
+	}
+	decision = p.filters.evaluate(&Anime{Genres: []string{"Sports"}, Studios: []string{"MAPPA"}})
+	if decision.notify || decision.rule != "genres blacklist" {
+		t.Errorf("the legacy blacklist should still apply: %+v", decision)
+	}
+}
+
+func TestFiltersAniListStats(t *testing.T) {
+	p, err := newProfile(ProfileConfig{
+		Name:        DefaultProfile,
+		MinScore:    7,
+		MinScoredBy: 1000,
+		Notifiers:   []Notifier{&WebhookNotifier{name: "webhook"}},
+	})
+	if err != nil {
+		t.Fatalf("can't create profile: %v", err)
+	}
+	for _, tc := range []struct {
+		name   string
+		anime  *Anime
+		notify bool
+		rule   string
+	}{
+		{
+			name:   "MyAnimeList statistics",
+			anime:  &Anime{StatsSource: statsMyAnimeList, Score: 8, ScoredBy: 5000},
+			notify: true,
+			rule:   "default",
+		},
+		{
+			name:  "AniList score under the threshold",
+			anime: &Anime{StatsSource: statsAniList, Score: 6.5, AniListScore: 65},
+			rule:  "minimum score",
+		},
+		{
+			name:  "AniList without score",
+			anime: &Anime{StatsSource: statsAniList},
+			rule:  "minimum score",
+		},
+		{
+			name:  "AniList does not provide the votes",
+			anime: &Anime{StatsSource: statsAniList, Score: 8, AniListScore: 80, Members: 50000},
+			rule:  "minimum votes",
+		},
+	} {
+		decision := p.filters.evaluate(tc.anime)
+		if decision.notify != tc.notify || decision.rule != tc.rule {
+			t.Errorf("%s: unexpected decision: %+v", tc.name, decision)
+		}
+		// missing statistics may come later: the anime must be evaluated again during the cool-down
+		if !decision.notify && !decision.volatile {
+			t.Errorf("%s: a statistics rejection must be volatile: %+v", tc.name, decision)
+		}
+	}
+}
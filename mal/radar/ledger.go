@@ -0,0 +1,60 @@
+package radar
+
+import (
+	"time"
+)
+
+const (
+	ledgerFile = "sent_notifications.json"
+	// ledgerVersion is the current version of the ledger file schema
+	ledgerVersion = 1
+)
+
+// ledgerKey identifies a sent notification: an anime is notified at most once per profile
+type ledgerKey struct {
+	MalID   int
+	Profile string
+}
+
+// ledgerEntry is a successfully sent notification
+type ledgerEntry struct {
+	MalID   int       `json:"mal_id"`
+	Profile string    `json:"profile"`
+	Title   string    `json:"title"`
+	Date    time.Time `json:"date"`
+}
+
+// ledgerDocument is the content of the ledger file
+type ledgerDocument struct {
+	Version int           `json:"version"`
+	Sent    []ledgerEntry `json:"sent"`
+}
+
+// alreadySent returns the date of the previous successful notification of an anime
+// for a profile, zero if it has never been notified.
+func (c *Controller) alreadySent(p *profile, malID int) (date time.Time) {
+	c.update.Lock()
+	defer c.update.Unlock()
+	date, err := c.store.sentNotification(malID, p.name)
+	if err != nil {
+		// better to notify twice than never
+		c.log.Errorf("[MAL] [Store] can't check if MalID %d has already been notified for profile '%s': %v",
+			malID, p.name, err)
+	}
+	return
+}
+
+// recordSent adds an anime to the sent notifications ledger of a profile.
+// c.update must be held by the caller.
+func (c *Controller) recordSent(p *profile, malID int, title string) {
+	entry := ledgerEntry{
+		MalID:   malID,
+		Profile: p.name,
+		Title:   title,
+		Date:    time.Now(),
+	}
+	if err := c.store.recordSent(entry); err != nil {
+		c.log.Errorf("[MAL] [Store] can't record '%s' (MalID %d) as notified for profile '%s': %v",
+			title, malID, p.name, err)
+	}
+}
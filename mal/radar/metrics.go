@@ -0,0 +1,230 @@
+package radar
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "malradar"
+	// filteredByUserList is the reason label used when an anime is filtered out by the profile user list
+	filteredByUserList = "user list"
+)
+
+// metrics holds the Prometheus collectors of a controller
+type metrics struct {
+	jikanRequests      *prometheus.CounterVec
+	malRequests        *prometheus.CounterVec
+	anilistRequests    *prometheus.CounterVec
+	retries            *prometheus.CounterVec
+	limiterWait        prometheus.Histogram
+	batchDuration      prometheus.Histogram
+	batches            *prometheus.CounterVec
+	lastBatchDuration  prometheus.Gauge
+	filtered           *prometheus.CounterVec
+	notifications      *prometheus.CounterVec
+	userListErrors     *prometheus.CounterVec
+	trackedDescription *prometheus.Desc
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		jikanRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "jikan",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests sent to the Jikan API by endpoint and outcome.",
+		}, []string{"endpoint", "outcome"}),
+		malRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "malapi",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests sent to the official MyAnimeList API by endpoint and outcome.",
+		}, []string{"endpoint", "outcome"}),
+		anilistRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "anilist",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests sent to the AniList API by query and outcome.",
+		}, []string{"endpoint", "outcome"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "retries_total",
+			Help:      "Number of requests retried after a failure by operation.",
+		}, []string{"operation"}),
+		limiterWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "ratelimiter",
+			Name:      "wait_seconds",
+			Help:      "Time spent waiting for the rate limiter before a request.",
+			Buckets:   []float64{0, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60},
+		}),
+		batchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "batch",
+			Name:      "duration_seconds",
+			Help:      "Duration of the batches.",
+			Buckets:   prometheus.ExponentialBuckets(30, 2, 10),
+		}),
+		batches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "batch",
+			Name:      "total",
+			Help:      "Number of executed batches by result.",
+		}, []string{"result"}),
+		lastBatchDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "batch",
+			Name:      "last_duration_seconds",
+			Help:      "Duration of the last batch.",
+		}),
+		filtered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "filtered_total",
+			Help:      "Number of finished animes filtered out by profile and reason (filter rule name or user list).",
+		}, []string{"profile", "reason"}),
+		notifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "notifications_total",
+			Help:      "Number of notifications by profile, notifier backend and outcome.",
+		}, []string{"profile", "notifier", "outcome"}),
+		userListErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "userlist",
+			Name:      "fetch_errors_total",
+			Help:      "Number of failed MyAnimeList user list retrievals by profile.",
+		}, []string{"profile"}),
+		trackedDescription: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "tracked_animes"),
+			"Number of animes in the watch list by airing status.",
+			[]string{"status"}, nil,
+		),
+	}
+}
+
+// RegisterMetrics registers the controller metrics within reg
+func (c *Controller) RegisterMetrics(reg prometheus.Registerer) (err error) {
+	for _, collector := range []prometheus.Collector{
+		c.metrics.jikanRequests,
+		c.metrics.malRequests,
+		c.metrics.anilistRequests,
+		c.metrics.retries,
+		c.metrics.limiterWait,
+		c.metrics.batchDuration,
+		c.metrics.batches,
+		c.metrics.lastBatchDuration,
+		c.metrics.filtered,
+		c.metrics.notifications,
+		c.metrics.userListErrors,
+		trackedCollector{c},
+	} {
+		if err = reg.Register(collector); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// trackedCollector reports the watch list content at scrape time
+type trackedCollector struct {
+	c *Controller
+}
+
+func (tc trackedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tc.c.metrics.trackedDescription
+}
+
+func (tc trackedCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := map[string]int{
+		animeStatusNotAired: 0,
+		animeStatusOnGoing:  0,
+		animeStatusFinished: 0,
+	}
+	tc.c.update.Lock()
+	for _, state := range tc.c.watchList {
+		counts[state.Status]++
+	}
+	tc.c.update.Unlock()
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(tc.c.metrics.trackedDescription, prometheus.GaugeValue, float64(count), status)
+	}
+}
+
+func (m *metrics) batchEnded(result BatchResult) {
+	m.batchDuration.Observe(result.DurationSeconds)
+	m.lastBatchDuration.Set(result.DurationSeconds)
+	if result.Error != "" {
+		m.batches.WithLabelValues("failure").Inc()
+	} else {
+		m.batches.WithLabelValues("success").Inc()
+	}
+}
+
+func (m *metrics) notification(p *profile, notifier string, err error) {
+	if err != nil {
+		m.notifications.WithLabelValues(p.name, notifier, "failed").Inc()
+	} else {
+		m.notifications.WithLabelValues(p.name, notifier, "sent").Inc()
+	}
+}
+
+// instrumentedTransport counts the requests sent to an anime source API
+type instrumentedTransport struct {
+	next     http.RoundTripper
+	requests *prometheus.CounterVec
+	// apiPrefix is removed from the requests path to get the endpoint
+	apiPrefix string
+}
+
+func (it *instrumentedTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if resp, err = it.next.RoundTrip(req); err != nil {
+		it.requests.WithLabelValues(apiEndpoint(req, it.apiPrefix), "error").Inc()
+		return
+	}
+	it.requests.WithLabelValues(apiEndpoint(req, it.apiPrefix), requestOutcome(resp.StatusCode)).Inc()
+	return
+}
+
+// endpointKey is the context key of the endpoint label set by withEndpoint
+type endpointKey struct{}
+
+// withEndpoint sets the endpoint label of the requests made with ctx, for the APIs using a single URL
+func withEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// apiEndpoint returns the first element of the API path to keep the label cardinality low
+func apiEndpoint(req *http.Request, apiPrefix string) string {
+	if endpoint, ok := req.Context().Value(endpointKey{}).(string); ok {
+		return endpoint
+	}
+	path := strings.TrimPrefix(req.URL.Path, apiPrefix)
+	if endpoint := strings.Split(strings.TrimPrefix(path, "/"), "/")[0]; endpoint != "" {
+		return endpoint
+	}
+	return "unknown"
+}
+
+func requestOutcome(code int) string {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return strconv.Itoa(code)
+	case code >= 200 && code < 300:
+		return "2xx"
+	case code >= 300 && code < 400:
+		return "3xx"
+	case code >= 400 && code < 500:
+		return "4xx"
+	default:
+		return "5xx"
+	}
+}
+
+func observeSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
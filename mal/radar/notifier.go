@@ -0,0 +1,223 @@
+package radar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	notifierHTTPTimeout = 30 * time.Second
+)
+
+var (
+	notifierHTTPClient = &http.Client{Timeout: notifierHTTPTimeout}
+	htmlTagsRegex      = regexp.MustCompile(`<[^>]+>`)
+	markdownReplacer   = strings.NewReplacer("<b>", "**", "</b>", "**", "<i>", "*", "</i>", "*", "<u>", "__", "</u>", "__")
+	// htmlTagsRestorer brings back the simple HTML tags once the message has been escaped
+	htmlTagsRestorer = strings.NewReplacer("&lt;b&gt;", "<b>", "&lt;/b&gt;", "</b>", "&lt;i&gt;", "<i>", "&lt;/i&gt;", "</i>",
+		"&lt;u&gt;", "<u>", "&lt;/u&gt;", "</u>", "\n", "<br>\n")
+)
+
+// Notifier is the interface every notification backend must implement in order to be used by the radar
+type Notifier interface {
+	// Name returns a short identifier of the backend, used in logs
+	Name() string
+	// Notify delivers a single notification
+	Notify(ctx context.Context, notif Notification) error
+}
+
+// BatchNotifier can be implemented by a Notifier wanting to deliver all the notifications of a batch at once
+// (as a digest for example) instead of one by one. Notify is still used for the text only notifications.
+type BatchNotifier interface {
+	Notifier
+	// NotifyBatch delivers all the anime notifications of a batch
+	NotifyBatch(ctx context.Context, notifs []Notification) error
+}
+
+// Notification is a rendered message ready to be delivered by any Notifier.
+// Anime is nil for pure text notifications (like the daemon start/stop messages).
+type Notification struct {
+	Title        string
+	Message      string // can contain simple HTML tags (<b>, <i>, <u>)
+	URL          string
+	URLTitle     string
+	Timestamp    time.Time
+	HighPriority bool
+	ImageURL     string
+	Image        []byte
+	Anime        *Anime
+}
+
+// PlainMessage returns the message without any HTML tags
+func (n Notification) PlainMessage() string {
+	return htmlTagsRegex.ReplaceAllString(n.Message, "")
+}
+
+// HTMLMessage returns the message ready to be inserted within an HTML document: everything but
+// its simple HTML tags is escaped (the anime titles and synopsis for example) and line breaks are kept
+func (n Notification) HTMLMessage() string {
+	return htmlTagsRestorer.Replace(html.EscapeString(n.Message))
+}
+
+// MarkdownMessage returns the message with its simple HTML tags converted to markdown
+func (n Notification) MarkdownMessage() string {
+	return htmlTagsRegex.ReplaceAllString(markdownReplacer.Replace(n.Message), "")
+}
+
+// NotifiersConfig regroups the configuration of all the available notification backends.
+// Each backend can be declared several times (for example to notify several discord channels):
+// their optional name tells them apart in logs and metrics.
+type NotifiersConfig struct {
+	Pushover []PushoverConfig `json:"pushover"`
+	Discord  []DiscordConfig  `json:"discord"`
+	Slack    []SlackConfig    `json:"slack"`
+	Webhook  []WebhookConfig  `json:"webhook"`
+	SMTP     []SMTPConfig     `json:"smtp"`
+	Gotify   []GotifyConfig   `json:"gotify"`
+	Ntfy     []NtfyConfig     `json:"ntfy"`
+}
+
+// NewNotifiers instanciates every backend declared within conf
+func NewNotifiers(conf NotifiersConfig) (notifiers []Notifier, err error) {
+	var notifier Notifier
+	for index, backendConf := range conf.Pushover {
+		backendConf.Name = defaultNotifierName(backendConf.Name, "pushover", index)
+		if notifier, err = NewPushoverNotifier(backendConf); err != nil {
+			err = fmt.Errorf("pushover notifier #%d: %w", index+1, err)
+			return
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	for index, backendConf := range conf.Discord {
+		backendConf.Name = defaultNotifierName(backendConf.Name, "discord", index)
+		if notifier, err = NewDiscordNotifier(backendConf); err != nil {
+			err = fmt.Errorf("discord notifier #%d: %w", index+1, err)
+			return
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	for index, backendConf := range conf.Slack {
+		backendConf.Name = defaultNotifierName(backendConf.Name, "slack", index)
+		if notifier, err = NewSlackNotifier(backendConf); err != nil {
+			err = fmt.Errorf("slack notifier #%d: %w", index+1, err)
+			return
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	for index, backendConf := range conf.Webhook {
+		backendConf.Name = defaultNotifierName(backendConf.Name, "webhook", index)
+		if notifier, err = NewWebhookNotifier(backendConf); err != nil {
+			err = fmt.Errorf("webhook notifier #%d: %w", index+1, err)
+			return
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	for index, backendConf := range conf.SMTP {
+		if backendConf.Digest {
+			backendConf.Name = defaultNotifierName(backendConf.Name, "smtp digest", index)
+			notifier, err = NewSMTPDigestNotifier(backendConf)
+		} else {
+			backendConf.Name = defaultNotifierName(backendConf.Name, "smtp", index)
+			notifier, err = NewSMTPNotifier(backendConf)
+		}
+		if err != nil {
+			err = fmt.Errorf("smtp notifier #%d: %w", index+1, err)
+			return
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	for index, backendConf := range conf.Gotify {
+		backendConf.Name = defaultNotifierName(backendConf.Name, "gotify", index)
+		if notifier, err = NewGotifyNotifier(backendConf); err != nil {
+			err = fmt.Errorf("gotify notifier #%d: %w", index+1, err)
+			return
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	for index, backendConf := range conf.Ntfy {
+		backendConf.Name = defaultNotifierName(backendConf.Name, "ntfy", index)
+		if notifier, err = NewNtfyNotifier(backendConf); err != nil {
+			err = fmt.Errorf("ntfy notifier #%d: %w", index+1, err)
+			return
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	names := make(map[string]bool, len(notifiers))
+	for _, notifier := range notifiers {
+		if names[notifier.Name()] {
+			return nil, fmt.Errorf("notifier name '%s' is used more than once", notifier.Name())
+		}
+		names[notifier.Name()] = true
+	}
+	return
+}
+
+// notifierName returns the configured name of a notifier, its backend name otherwise
+func notifierName(configured, backend string) string {
+	if configured != "" {
+		return configured
+	}
+	return backend
+}
+
+// defaultNotifierName numbers the unnamed backends declared more than once: the first one keeps the backend name
+func defaultNotifierName(configured, backend string, index int) string {
+	if configured != "" || index == 0 {
+		return configured
+	}
+	return fmt.Sprintf("%s #%d", backend, index+1)
+}
+
+func postJSON(ctx context.Context, url string, payload interface{}, headers map[string]string) (err error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("can't marshal payload as JSON: %w", err)
+	}
+	if headers == nil {
+		headers = make(map[string]string, 1)
+	}
+	headers["Content-Type"] = "application/json"
+	return post(ctx, url, bytes.NewReader(body), headers)
+}
+
+func post(ctx context.Context, url string, body io.Reader, headers map[string]string) (err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return fmt.Errorf("can't create request: %w", err)
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	response, err := notifierHTTPClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		answer, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("%w: %s", &httpStatusError{
+			code:   response.StatusCode,
+			status: response.Status,
+		}, strings.TrimSpace(string(answer)))
+	}
+	return
+}
+
+func checkURL(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s must be set", name)
+	}
+	if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+		return fmt.Errorf("%s must be an http(s) URL: %s", name, value)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package radar
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	discordEmbedColor = 0x2e51a2 // MyAnimeList blue
+)
+
+// DiscordConfig holds the configuration of a discord notifier
+type DiscordConfig struct {
+	Name       string `json:"name"`
+	WebhookURL string `json:"webhook_url"`
+	Username   string `json:"username"`
+}
+
+// DiscordNotifier delivers notifications thru a discord channel webhook
+type DiscordNotifier struct {
+	name       string
+	webhookURL string
+	username   string
+}
+
+// NewDiscordNotifier returns an initialized discord notifier
+func NewDiscordNotifier(conf DiscordConfig) (dn *DiscordNotifier, err error) {
+	if err = checkURL("discord webhook URL", conf.WebhookURL); err != nil {
+		return
+	}
+	dn = &DiscordNotifier{
+		name:       notifierName(conf.Name, "discord"),
+		webhookURL: conf.WebhookURL,
+		username:   conf.Username,
+	}
+	return
+}
+
+// Name returns the notifier name
+func (dn *DiscordNotifier) Name() string {
+	return dn.name
+}
+
+type discordPayload struct {
+	Username string         `json:"username,omitempty"`
+	Content  string         `json:"content,omitempty"`
+	Embeds   []discordEmbed `json:"embeds,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	URL         string             `json:"url,omitempty"`
+	Timestamp   string             `json:"timestamp,omitempty"`
+	Color       int                `json:"color,omitempty"`
+	Image       *discordEmbedImage `json:"image,omitempty"`
+}
+
+type discordEmbedImage struct {
+	URL string `json:"url"`
+}
+
+// Notify sends notif as a discord embed (or a simple message for text only notifications)
+func (dn *DiscordNotifier) Notify(ctx context.Context, notif Notification) error {
+	payload := discordPayload{
+		Username: dn.username,
+	}
+	if notif.Anime == nil {
+		payload.Content = notif.MarkdownMessage()
+	} else {
+		embed := discordEmbed{
+			Title:       notif.Title,
+			Description: notif.MarkdownMessage(),
+			URL:         notif.URL,
+			Color:       discordEmbedColor,
+		}
+		if !notif.Timestamp.IsZero() {
+			embed.Timestamp = notif.Timestamp.Format(time.RFC3339)
+		}
+		if notif.ImageURL != "" {
+			embed.Image = &discordEmbedImage{URL: notif.ImageURL}
+		}
+		payload.Embeds = []discordEmbed{embed}
+	}
+	return postJSON(ctx, dn.webhookURL, payload, nil)
+}
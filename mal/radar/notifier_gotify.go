@@ -0,0 +1,93 @@
+package radar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	gotifyDefaultPriority = 5
+	gotifyHighPriority    = 8
+)
+
+// GotifyConfig holds the configuration of a gotify notifier
+type GotifyConfig struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Token    string `json:"application_token"`
+	Priority int    `json:"priority"`
+}
+
+// GotifyNotifier delivers notifications thru a gotify server (https://gotify.net/)
+type GotifyNotifier struct {
+	name     string
+	endpoint string
+	token    string
+	priority int
+}
+
+// NewGotifyNotifier returns an initialized gotify notifier
+func NewGotifyNotifier(conf GotifyConfig) (gn *GotifyNotifier, err error) {
+	if err = checkURL("gotify URL", conf.URL); err != nil {
+		return
+	}
+	if conf.Token == "" {
+		err = errors.New("gotify application token must be set")
+		return
+	}
+	if conf.Priority == 0 {
+		conf.Priority = gotifyDefaultPriority
+	}
+	gn = &GotifyNotifier{
+		name:     notifierName(conf.Name, "gotify"),
+		endpoint: strings.TrimSuffix(conf.URL, "/") + "/message",
+		token:    conf.Token,
+		priority: conf.Priority,
+	}
+	return
+}
+
+// Name returns the notifier name
+func (gn *GotifyNotifier) Name() string {
+	return gn.name
+}
+
+type gotifyPayload struct {
+	Title    string                 `json:"title,omitempty"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+// Notify sends notif as a markdown gotify message
+func (gn *GotifyNotifier) Notify(ctx context.Context, notif Notification) error {
+	message := notif.MarkdownMessage()
+	if notif.ImageURL != "" {
+		message = fmt.Sprintf("![%s](%s)\n\n%s", notif.Title, notif.ImageURL, message)
+	}
+	payload := gotifyPayload{
+		Title:    notif.Title,
+		Message:  strings.ReplaceAll(message, "\n", "  \n"), // markdown line breaks
+		Priority: gn.priority,
+		Extras: map[string]interface{}{
+			"client::display": map[string]string{
+				"contentType": "text/markdown",
+			},
+		},
+	}
+	if notif.HighPriority && payload.Priority < gotifyHighPriority {
+		payload.Priority = gotifyHighPriority
+	}
+	if notif.URL != "" {
+		payload.Extras["client::notification"] = map[string]interface{}{
+			"click": map[string]string{
+				"url": notif.URL,
+			},
+		}
+	}
+	return postJSON(ctx, gn.endpoint, payload, map[string]string{
+		"X-Gotify-Key": gn.token,
+	})
+}
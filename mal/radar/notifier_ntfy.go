@@ -0,0 +1,84 @@
+package radar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+const (
+	ntfyDefaultServer = "https://ntfy.sh"
+)
+
+// NtfyConfig holds the configuration of a ntfy notifier
+type NtfyConfig struct {
+	Name     string `json:"name"`
+	Server   string `json:"server"`
+	Topic    string `json:"topic"`
+	Token    string `json:"access_token"`
+	Priority int    `json:"priority"`
+}
+
+// NtfyNotifier delivers notifications thru a ntfy topic (https://ntfy.sh/)
+type NtfyNotifier struct {
+	name     string
+	endpoint string
+	token    string
+	priority int
+}
+
+// NewNtfyNotifier returns an initialized ntfy notifier
+func NewNtfyNotifier(conf NtfyConfig) (nn *NtfyNotifier, err error) {
+	if conf.Server == "" {
+		conf.Server = ntfyDefaultServer
+	} else if err = checkURL("ntfy server", conf.Server); err != nil {
+		return
+	}
+	if conf.Topic == "" {
+		err = errors.New("ntfy topic must be set")
+		return
+	}
+	if conf.Priority < 0 || conf.Priority > 5 {
+		err = fmt.Errorf("ntfy priority must be between 1 and 5 (0 for server default): %d", conf.Priority)
+		return
+	}
+	nn = &NtfyNotifier{
+		name:     notifierName(conf.Name, "ntfy"),
+		endpoint: strings.TrimSuffix(conf.Server, "/") + "/" + conf.Topic,
+		token:    conf.Token,
+		priority: conf.Priority,
+	}
+	return
+}
+
+// Name returns the notifier name
+func (nn *NtfyNotifier) Name() string {
+	return nn.name
+}
+
+// Notify publishes notif on the configured ntfy topic
+func (nn *NtfyNotifier) Notify(ctx context.Context, notif Notification) error {
+	headers := map[string]string{
+		"Markdown": "yes",
+	}
+	if notif.Title != "" {
+		headers["Title"] = mime.QEncoding.Encode("utf-8", notif.Title)
+	}
+	if notif.HighPriority {
+		headers["Priority"] = "4"
+	} else if nn.priority != 0 {
+		headers["Priority"] = fmt.Sprintf("%d", nn.priority)
+	}
+	if notif.URL != "" {
+		headers["Click"] = notif.URL
+	}
+	if notif.ImageURL != "" {
+		headers["Attach"] = notif.ImageURL
+	}
+	if nn.token != "" {
+		headers["Authorization"] = "Bearer " + nn.token
+	}
+	return post(ctx, nn.endpoint, strings.NewReader(notif.MarkdownMessage()), headers)
+}
@@ -0,0 +1,66 @@
+package radar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/hekmon/pushover/v2"
+)
+
+// PushoverConfig holds the configuration of a pushover notifier
+type PushoverConfig struct {
+	Name           string `json:"name"`
+	UserKey        string `json:"user_key"`
+	ApplicationKey string `json:"application_key"`
+}
+
+// PushoverNotifier delivers notifications thru pushover (https://pushover.net/)
+type PushoverNotifier struct {
+	name   string
+	client *pushover.Controller
+}
+
+// NewPushoverNotifier returns an initialized pushover notifier
+func NewPushoverNotifier(conf PushoverConfig) (pn *PushoverNotifier, err error) {
+	if conf.ApplicationKey == "" {
+		err = errors.New("pushover application key must be set")
+		return
+	}
+	if conf.UserKey == "" {
+		err = errors.New("pushover user key must be set")
+		return
+	}
+	pn = &PushoverNotifier{
+		name:   notifierName(conf.Name, "pushover"),
+		client: pushover.New(&conf.ApplicationKey, &conf.UserKey),
+	}
+	return
+}
+
+// Name returns the notifier name
+func (pn *PushoverNotifier) Name() string {
+	return pn.name
+}
+
+// Notify sends notif as a pushover message
+func (pn *PushoverNotifier) Notify(ctx context.Context, notif Notification) error {
+	msg := pushover.Message{
+		Message:  notif.Message,
+		Title:    notif.Title,
+		Priority: pushover.PriorityNormal,
+		URL:      notif.URL,
+		URLTitle: notif.URLTitle,
+		HTML:     true,
+	}
+	if notif.HighPriority {
+		msg.Priority = pushover.PriorityHigh
+	}
+	if !notif.Timestamp.IsZero() {
+		msg.Timestamp = notif.Timestamp.Unix()
+	}
+	if len(notif.Image) > 0 {
+		msg.Attachment = bytes.NewReader(notif.Image)
+	}
+	return pn.client.SendCustomMsg(msg)
+}
@@ -0,0 +1,94 @@
+package radar
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+var (
+	slackReplacer = strings.NewReplacer("<b>", "*", "</b>", "*", "<i>", "_", "</i>", "_", "<u>", "", "</u>", "")
+)
+
+// SlackConfig holds the configuration of a slack notifier
+type SlackConfig struct {
+	Name       string `json:"name"`
+	WebhookURL string `json:"webhook_url"`
+}
+
+// SlackNotifier delivers notifications thru a slack incoming webhook
+type SlackNotifier struct {
+	name       string
+	webhookURL string
+}
+
+// NewSlackNotifier returns an initialized slack notifier
+func NewSlackNotifier(conf SlackConfig) (sn *SlackNotifier, err error) {
+	if err = checkURL("slack webhook URL", conf.WebhookURL); err != nil {
+		return
+	}
+	sn = &SlackNotifier{
+		name:       notifierName(conf.Name, "slack"),
+		webhookURL: conf.WebhookURL,
+	}
+	return
+}
+
+// Name returns the notifier name
+func (sn *SlackNotifier) Name() string {
+	return sn.name
+}
+
+type slackPayload struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks,omitempty"`
+}
+
+type slackBlock struct {
+	Type      string      `json:"type"`
+	Text      *slackText  `json:"text,omitempty"`
+	Accessory *slackImage `json:"accessory,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackImage struct {
+	Type     string `json:"type"`
+	ImageURL string `json:"image_url"`
+	AltText  string `json:"alt_text"`
+}
+
+// Notify sends notif as a slack message
+func (sn *SlackNotifier) Notify(ctx context.Context, notif Notification) error {
+	text := htmlTagsRegex.ReplaceAllString(slackReplacer.Replace(notif.Message), "")
+	if notif.Title != "" {
+		if notif.URL != "" {
+			text = fmt.Sprintf("*<%s|%s>*\n%s", notif.URL, notif.Title, text)
+		} else {
+			text = fmt.Sprintf("*%s*\n%s", notif.Title, text)
+		}
+	}
+	payload := slackPayload{
+		Text: text,
+	}
+	if notif.ImageURL != "" {
+		payload.Blocks = []slackBlock{
+			{
+				Type: "section",
+				Text: &slackText{
+					Type: "mrkdwn",
+					Text: text,
+				},
+				Accessory: &slackImage{
+					Type:     "image",
+					ImageURL: notif.ImageURL,
+					AltText:  notif.Title,
+				},
+			},
+		}
+	}
+	return postJSON(ctx, sn.webhookURL, payload, nil)
+}
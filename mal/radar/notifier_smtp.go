@@ -0,0 +1,165 @@
+package radar
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	smtpDefaultPort = 587
+)
+
+// SMTPConfig holds the configuration of an e-mail notifier
+type SMTPConfig struct {
+	Name     string   `json:"name"`
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	StartTLS bool     `json:"starttls"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Digest   bool     `json:"digest"`
+}
+
+// SMTPNotifier delivers notifications as HTML e-mails
+type SMTPNotifier struct {
+	name     string
+	address  string
+	host     string
+	startTLS bool
+	auth     smtp.Auth
+	from     string
+	to       []string
+}
+
+// NewSMTPNotifier returns an initialized e-mail notifier
+func NewSMTPNotifier(conf SMTPConfig) (sn *SMTPNotifier, err error) {
+	if conf.Host == "" {
+		err = errors.New("smtp host must be set")
+		return
+	}
+	if conf.Port == 0 {
+		conf.Port = smtpDefaultPort
+	}
+	if conf.From == "" {
+		err = errors.New("smtp from address must be set")
+		return
+	}
+	if len(conf.To) == 0 {
+		err = errors.New("at least one smtp recipient must be set")
+		return
+	}
+	sn = &SMTPNotifier{
+		name:     notifierName(conf.Name, "smtp"),
+		address:  net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port)),
+		host:     conf.Host,
+		startTLS: conf.StartTLS,
+		from:     conf.From,
+		to:       conf.To,
+	}
+	if conf.Username != "" {
+		sn.auth = smtp.PlainAuth("", conf.Username, conf.Password, conf.Host)
+	}
+	return
+}
+
+// Name returns the notifier name
+func (sn *SMTPNotifier) Name() string {
+	return sn.name
+}
+
+// Notify sends notif as an HTML e-mail
+func (sn *SMTPNotifier) Notify(ctx context.Context, notif Notification) error {
+	var body strings.Builder
+	body.WriteString("<html><body>\n")
+	if notif.Title != "" {
+		fmt.Fprintf(&body, "<h2>%s</h2>\n", html.EscapeString(notif.Title))
+	}
+	if notif.ImageURL != "" {
+		fmt.Fprintf(&body, "<p><img src=\"%s\" alt=\"%s\"></p>\n",
+			html.EscapeString(notif.ImageURL), html.EscapeString(notif.Title))
+	}
+	fmt.Fprintf(&body, "<p>%s</p>\n", notif.HTMLMessage())
+	if notif.URL != "" {
+		fmt.Fprintf(&body, "<p><a href=\"%s\">%s</a></p>\n",
+			html.EscapeString(notif.URL), html.EscapeString(notif.URLTitle))
+	}
+	body.WriteString("</body></html>\n")
+	subject := notif.Title
+	if subject == "" {
+		subject = "MyAnimeList Radar"
+	}
+	return sn.send(ctx, subject, "text/html; charset=utf-8", []byte(body.String()))
+}
+
+func (sn *SMTPNotifier) send(ctx context.Context, subject, contentType string, body []byte) (err error) {
+	// build the message
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", sn.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(sn.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s\r\n", contentType)
+	msg.WriteString("\r\n")
+	msg.Write(body)
+	// connect
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", sn.address)
+	if err != nil {
+		return fmt.Errorf("can't connect to '%s': %w", sn.address, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(notifierHTTPTimeout))
+	}
+	client, err := smtp.NewClient(conn, sn.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("can't initiate smtp session with '%s': %w", sn.address, err)
+	}
+	defer client.Close()
+	if sn.startTLS {
+		if err = client.StartTLS(&tls.Config{ServerName: sn.host}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if sn.auth != nil {
+		if err = client.Auth(sn.auth); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+	// send
+	if err = client.Mail(sn.from); err != nil {
+		return fmt.Errorf("MAIL FROM failed: %w", err)
+	}
+	for _, recipient := range sn.to {
+		if err = client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("RCPT TO '%s' failed: %w", recipient, err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA failed: %w", err)
+	}
+	if _, err = writer.Write(msg.Bytes()); err != nil {
+		writer.Close()
+		return fmt.Errorf("can't write message: %w", err)
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,107 @@
+package radar
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	smtpMIMELineLength = 76
+)
+
+// SMTPDigestNotifier delivers a single HTML e-mail per batch listing all the notified animes,
+// with their cover images inlined.
+type SMTPDigestNotifier struct {
+	*SMTPNotifier
+}
+
+// NewSMTPDigestNotifier returns an initialized e-mail digest notifier
+func NewSMTPDigestNotifier(conf SMTPConfig) (sdn *SMTPDigestNotifier, err error) {
+	sn, err := NewSMTPNotifier(conf)
+	if err != nil {
+		return
+	}
+	sn.name = notifierName(conf.Name, "smtp digest")
+	sdn = &SMTPDigestNotifier{
+		SMTPNotifier: sn,
+	}
+	return
+}
+
+// NotifyBatch sends all notifs within a single HTML e-mail
+func (sdn *SMTPDigestNotifier) NotifyBatch(ctx context.Context, notifs []Notification) (err error) {
+	if len(notifs) == 0 {
+		return
+	}
+	// prepare the multipart body
+	var (
+		body    bytes.Buffer
+		content strings.Builder
+	)
+	writer := multipart.NewWriter(&body)
+	fmt.Fprintf(&content, "<html><body>\n<h1>%d new finished anime(s)</h1>\n", len(notifs))
+	images := make(map[string][]byte, len(notifs))
+	for index, notif := range notifs {
+		content.WriteString("<hr>\n")
+		fmt.Fprintf(&content, "<h2><a href=\"%s\">%s</a></h2>\n",
+			html.EscapeString(notif.URL), html.EscapeString(notif.Title))
+		if len(notif.Image) > 0 {
+			cid := fmt.Sprintf("anime%d-%d@malradar", index, notif.Anime.MalID)
+			images[cid] = notif.Image
+			fmt.Fprintf(&content, "<p><img src=\"cid:%s\" alt=\"%s\"></p>\n", cid, html.EscapeString(notif.Title))
+		} else if notif.ImageURL != "" {
+			fmt.Fprintf(&content, "<p><img src=\"%s\" alt=\"%s\"></p>\n",
+				html.EscapeString(notif.ImageURL), html.EscapeString(notif.Title))
+		}
+		fmt.Fprintf(&content, "<p>%s</p>\n", notif.HTMLMessage())
+	}
+	content.WriteString("</body></html>\n")
+	// html part
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return fmt.Errorf("can't create html part: %w", err)
+	}
+	writeBase64(part, []byte(content.String()))
+	// inlined images
+	for cid, image := range images {
+		if part, err = writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {http.DetectContentType(image)},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + cid + ">"},
+			"Content-Disposition":       {"inline"},
+		}); err != nil {
+			return fmt.Errorf("can't create image part: %w", err)
+		}
+		writeBase64(part, image)
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("can't finalize multipart body: %w", err)
+	}
+	// send it
+	return sdn.send(ctx,
+		fmt.Sprintf("MyAnimeList Radar digest: %d new anime(s) - %s", len(notifs), time.Now().Format("2006-01-02")),
+		fmt.Sprintf("multipart/related; type=\"text/html\"; boundary=%s", writer.Boundary()),
+		body.Bytes(),
+	)
+}
+
+func writeBase64(dst io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > smtpMIMELineLength {
+		dst.Write([]byte(encoded[:smtpMIMELineLength] + "\r\n"))
+		encoded = encoded[smtpMIMELineLength:]
+	}
+	dst.Write([]byte(encoded + "\r\n"))
+}
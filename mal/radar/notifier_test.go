@@ -0,0 +1,13 @@
+package radar
+
+import "testing"
+
+func TestHTMLMessage(t *testing.T) {
+	notif := Notification{
+		Message: "<b>Tom & Jerry</b> <script>alert(1)</script>\n<i>Score</i>: <u>8.5</u> <img src=x onerror=alert(1)>",
+	}
+	expected := "<b>Tom &amp; Jerry</b> &lt;script&gt;alert(1)&lt;/script&gt;<br>\n<i>Score</i>: <u>8.5</u> &lt;img src=x onerror=alert(1)&gt;"
+	if message := notif.HTMLMessage(); message != expected {
+		t.Errorf("unexpected HTML message:\n%s\nexpected:\n%s", message, expected)
+	}
+}
@@ -0,0 +1,238 @@
+package radar
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+const (
+	webhookDefaultRetries         = 3
+	webhookDefaultBackoff         = 2 * time.Second
+	webhookDefaultSignatureHeader = "X-Malradar-Signature"
+	webhookEventAnime             = "anime_finished"
+	webhookEventMessage           = "message"
+)
+
+// WebhookConfig holds the configuration of a generic webhook notifier
+type WebhookConfig struct {
+	Name            string            `json:"name"`
+	URL             string            `json:"url"`
+	Headers         map[string]string `json:"headers"`
+	Secret          string            `json:"hmac_secret"`
+	SignatureHeader string            `json:"signature_header"`
+	MaxRetries      *int              `json:"max_retries"`
+	Template        string            `json:"payload_template"`
+}
+
+// WebhookNotifier delivers notifications as JSON documents POSTed to an arbitrary URL
+type WebhookNotifier struct {
+	name            string
+	url             string
+	headers         map[string]string
+	secret          []byte
+	signatureHeader string
+	maxRetries      int
+	backoff         time.Duration
+	template        *template.Template
+}
+
+// NewWebhookNotifier returns an initialized generic webhook notifier
+func NewWebhookNotifier(conf WebhookConfig) (wn *WebhookNotifier, err error) {
+	if err = checkURL("webhook URL", conf.URL); err != nil {
+		return
+	}
+	wn = &WebhookNotifier{
+		name:            notifierName(conf.Name, "webhook"),
+		url:             conf.URL,
+		headers:         conf.Headers,
+		secret:          []byte(conf.Secret),
+		signatureHeader: conf.SignatureHeader,
+		maxRetries:      webhookDefaultRetries,
+		backoff:         webhookDefaultBackoff,
+	}
+	if wn.signatureHeader == "" {
+		wn.signatureHeader = webhookDefaultSignatureHeader
+	}
+	if conf.MaxRetries != nil {
+		if *conf.MaxRetries < 0 {
+			err = fmt.Errorf("webhook max retries can't be negative: %d", *conf.MaxRetries)
+			return
+		}
+		wn.maxRetries = *conf.MaxRetries
+	}
+	if conf.Template != "" {
+		if wn.template, err = template.New("webhook").Funcs(template.FuncMap{
+			"json": webhookJSONValue,
+		}).Parse(conf.Template); err != nil {
+			err = fmt.Errorf("can't parse webhook payload template: %w", err)
+			return
+		}
+	}
+	return
+}
+
+// Name returns the notifier name
+func (wn *WebhookNotifier) Name() string {
+	return wn.name
+}
+
+// WebhookPayload is the JSON document sent by the webhook notifier.
+// It is also the data passed to the user payload template if any.
+type WebhookPayload struct {
+	Event        string        `json:"event"`
+	Title        string        `json:"title"`
+	Message      string        `json:"message"`
+	URL          string        `json:"url,omitempty"`
+	ImageURL     string        `json:"image_url,omitempty"`
+	Timestamp    *time.Time    `json:"timestamp,omitempty"`
+	HighPriority bool          `json:"high_priority"`
+	Anime        *WebhookAnime `json:"anime,omitempty"`
+}
+
+// WebhookAnime describes the notified anime within a WebhookPayload
+type WebhookAnime struct {
+	MalID         int          `json:"mal_id"`
+	URL           string       `json:"url"`
+	Title         string       `json:"title"`
+	TitleEnglish  string       `json:"title_english,omitempty"`
+	TitleJapanese string       `json:"title_japanese,omitempty"`
+	TitleSynonyms []string     `json:"title_synonyms,omitempty"`
+	Type          string       `json:"type"`
+	Source        string       `json:"source"`
+	Episodes      int          `json:"episodes"`
+	Duration      string       `json:"duration"`
+	Rating        string       `json:"rating"`
+	Score         float64      `json:"score"`
+	AniListScore  float64      `json:"anilist_score,omitempty"`
+	ScoredBy      int          `json:"scored_by"`
+	Rank          int          `json:"rank"`
+	Popularity    int          `json:"popularity"`
+	Members       int          `json:"members"`
+	Genres        []string     `json:"genres"`
+	Studios       []string     `json:"studios"`
+	Aired         WebhookAired `json:"aired"`
+	ImageURL      string       `json:"image_url,omitempty"`
+}
+
+// WebhookAired contains the airing dates of a WebhookAnime
+type WebhookAired struct {
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+// Notify POSTs notif as a JSON document, retrying with an exponential backoff on network errors, 429 and 5xx
+func (wn *WebhookNotifier) Notify(ctx context.Context, notif Notification) (err error) {
+	body, err := wn.generateBody(notif)
+	if err != nil {
+		return
+	}
+	// prepare headers
+	headers := make(map[string]string, len(wn.headers)+2)
+	for key, value := range wn.headers {
+		headers[key] = value
+	}
+	headers["Content-Type"] = "application/json"
+	if len(wn.secret) > 0 {
+		mac := hmac.New(sha256.New, wn.secret)
+		mac.Write(body)
+		headers[wn.signatureHeader] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	// send it
+	backoff := wn.backoff
+	for try := 0; ; try++ {
+		if err = post(ctx, wn.url, bytes.NewReader(body), headers); err == nil {
+			return
+		}
+		// the others client errors will not be fixed by sending the same document again
+		if classifyError(err) != errorTransient {
+			return
+		}
+		if try == wn.maxRetries {
+			return fmt.Errorf("giving up after %d tries: %w", try+1, err)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (retry aborted: %v)", err, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func (wn *WebhookNotifier) generateBody(notif Notification) (body []byte, err error) {
+	payload := WebhookPayload{
+		Event:        webhookEventMessage,
+		Title:        notif.Title,
+		Message:      notif.PlainMessage(),
+		URL:          notif.URL,
+		ImageURL:     notif.ImageURL,
+		HighPriority: notif.HighPriority,
+	}
+	if !notif.Timestamp.IsZero() {
+		payload.Timestamp = &notif.Timestamp
+	}
+	if anime := notif.Anime; anime != nil {
+		payload.Event = webhookEventAnime
+		payload.Anime = &WebhookAnime{
+			MalID:         anime.MalID,
+			URL:           anime.URL,
+			Title:         anime.Title,
+			TitleEnglish:  anime.TitleEnglish,
+			TitleJapanese: anime.TitleJapanese,
+			TitleSynonyms: anime.TitleSynonyms,
+			Type:          anime.Type,
+			Source:        anime.Source,
+			Episodes:      anime.Episodes,
+			Duration:      anime.Duration,
+			Rating:        anime.Rating,
+			Score:         anime.Score,
+			AniListScore:  anime.AniListScore,
+			ScoredBy:      anime.ScoredBy,
+			Rank:          anime.Rank,
+			Popularity:    anime.Popularity,
+			Members:       anime.Members,
+			Genres:        anime.Genres,
+			Studios:       anime.Studios,
+			ImageURL:      notif.ImageURL,
+		}
+		if !anime.Aired.From.IsZero() {
+			payload.Anime.Aired.From = &anime.Aired.From
+		}
+		if !anime.Aired.To.IsZero() {
+			payload.Anime.Aired.To = &anime.Aired.To
+		}
+	}
+	// default document
+	if wn.template == nil {
+		if body, err = json.Marshal(payload); err != nil {
+			err = fmt.Errorf("can't marshal payload as JSON: %w", err)
+		}
+		return
+	}
+	// user template
+	var buffer bytes.Buffer
+	if err = wn.template.Execute(&buffer, payload); err != nil {
+		err = fmt.Errorf("can't execute payload template: %w", err)
+		return
+	}
+	if body = buffer.Bytes(); !json.Valid(body) {
+		err = errors.New("payload template did not generate a valid JSON document")
+	}
+	return
+}
+
+// webhookJSONValue allows templates to safely embed any value as JSON
+func webhookJSONValue(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
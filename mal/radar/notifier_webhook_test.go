@@ -0,0 +1,165 @@
+package radar
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookServer answers with the given status codes in turn (200 once exhausted) and records the last request
+type webhookServer struct {
+	*httptest.Server
+	statuses []int
+	calls    int32
+	header   http.Header
+	body     []byte
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) (ws *webhookServer) {
+	ws = &webhookServer{statuses: statuses}
+	ws.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(atomic.AddInt32(&ws.calls, 1)) - 1
+		ws.header = r.Header.Clone()
+		ws.body, _ = io.ReadAll(r.Body)
+		if call < len(ws.statuses) {
+			w.WriteHeader(ws.statuses[call])
+		}
+	}))
+	t.Cleanup(ws.Close)
+	return
+}
+
+func newTestWebhookNotifier(t *testing.T, conf WebhookConfig) *WebhookNotifier {
+	wn, err := NewWebhookNotifier(conf)
+	if err != nil {
+		t.Fatalf("can't create the webhook notifier: %v", err)
+	}
+	wn.backoff = time.Millisecond
+	return wn
+}
+
+func TestWebhookSignature(t *testing.T) {
+	ws := newWebhookServer(t)
+	wn := newTestWebhookNotifier(t, WebhookConfig{
+		URL:             ws.URL,
+		Secret:          "s3cr3t",
+		SignatureHeader: "X-Signature",
+		Headers:         map[string]string{"Authorization": "Bearer token"},
+	})
+	if err := wn.Notify(context.Background(), Notification{Title: "title", Message: "<b>message</b>"}); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write(ws.body)
+	if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); ws.header.Get("X-Signature") != expected {
+		t.Errorf("signature header is '%s', expected '%s'", ws.header.Get("X-Signature"), expected)
+	}
+	if ws.header.Get("Authorization") != "Bearer token" {
+		t.Errorf("custom header not sent: %v", ws.header)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(ws.body, &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if payload.Event != webhookEventMessage || payload.Message != "message" || payload.Anime != nil {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+}
+
+func TestWebhookNoSignatureWithoutSecret(t *testing.T) {
+	ws := newWebhookServer(t)
+	wn := newTestWebhookNotifier(t, WebhookConfig{URL: ws.URL})
+	if err := wn.Notify(context.Background(), Notification{Title: "title"}); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if signature := ws.header.Get(webhookDefaultSignatureHeader); signature != "" {
+		t.Errorf("unexpected signature without secret: %s", signature)
+	}
+}
+
+func TestWebhookPayloadTemplate(t *testing.T) {
+	ws := newWebhookServer(t)
+	wn := newTestWebhookNotifier(t, WebhookConfig{
+		URL:      ws.URL,
+		Template: `{"text": {{ json .Title }}, "id": {{ .Anime.MalID }}, "genres": {{ json .Anime.Genres }}}`,
+	})
+	notif := Notification{
+		Title: `Fullmetal "Brotherhood"`,
+		Anime: &Anime{MalID: 5114, Genres: []string{"Action", "Military"}},
+	}
+	if err := wn.Notify(context.Background(), notif); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	var document struct {
+		Text   string   `json:"text"`
+		ID     int      `json:"id"`
+		Genres []string `json:"genres"`
+	}
+	if err := json.Unmarshal(ws.body, &document); err != nil {
+		t.Fatalf("invalid templated payload '%s': %v", ws.body, err)
+	}
+	if document.Text != notif.Title || document.ID != 5114 || len(document.Genres) != 2 {
+		t.Errorf("unexpected templated payload: %s", ws.body)
+	}
+}
+
+func TestWebhookInvalidTemplateOutput(t *testing.T) {
+	ws := newWebhookServer(t)
+	wn := newTestWebhookNotifier(t, WebhookConfig{URL: ws.URL, Template: `{"text": {{ .Title }}}`})
+	if err := wn.Notify(context.Background(), Notification{Title: "not quoted"}); err == nil {
+		t.Fatal("an invalid JSON document must not be sent")
+	}
+	if ws.calls != 0 {
+		t.Errorf("%d request(s) sent with an invalid document", ws.calls)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	retries := 2
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		success  bool
+		calls    int32
+	}{
+		{name: "server error then success", statuses: []int{500, 503}, success: true, calls: 3},
+		{name: "rate limited then success", statuses: []int{429}, success: true, calls: 2},
+		{name: "server errors exhaust the retries", statuses: []int{500, 502, 503, 504}, success: false, calls: 3},
+		{name: "client error is not retried", statuses: []int{400}, success: false, calls: 1},
+		{name: "not found is not retried", statuses: []int{404}, success: false, calls: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ws := newWebhookServer(t, tc.statuses...)
+			wn := newTestWebhookNotifier(t, WebhookConfig{URL: ws.URL, MaxRetries: &retries})
+			err := wn.Notify(context.Background(), Notification{Title: "title"})
+			if tc.success && err != nil {
+				t.Errorf("notify failed: %v", err)
+			} else if !tc.success && err == nil {
+				t.Error("notify succeeded")
+			}
+			if ws.calls != tc.calls {
+				t.Errorf("%d request(s) sent, expected %d", ws.calls, tc.calls)
+			}
+		})
+	}
+}
+
+func TestWebhookRetryNetworkError(t *testing.T) {
+	ws := newWebhookServer(t)
+	url := ws.URL
+	ws.Close()
+	retries := 1
+	wn := newTestWebhookNotifier(t, WebhookConfig{URL: url, MaxRetries: &retries})
+	err := wn.Notify(context.Background(), Notification{Title: "title"})
+	if err == nil || classifyError(err) != errorTransient {
+		t.Errorf("expected a transient error after the retries, got: %v", err)
+	}
+}
@@ -1,194 +1,314 @@
 package radar
 
 import (
-	"bytes"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
-	"regexp"
 	"strings"
+	"time"
 
 	"github.com/hekmon/malradar/mal/userlist"
-
-	"github.com/darenliang/jikan-go"
-	"github.com/hekmon/pushover/v2"
 )
 
 const (
-	jikanFallbackImg = "https://cdn.myanimelist.net/img/sp/icon/apple-touch-icon-256.png"
-)
-
-var (
-	imageRegex = regexp.MustCompile(`https://cdn.myanimelist.net/images/anime/[0-9]+/[0-9]+\.jpg`)
+	// malFallbackImg is returned instead of the cover when an anime does not have one
+	malFallbackImg = "https://cdn.myanimelist.net/img/sp/icon/apple-touch-icon-256.png"
 )
 
-func (c *Controller) batchNotifier(animes []*jikan.Anime) {
+func (c *Controller) batchNotifier(animes []*Anime) {
 	// do we actually have work to do ?
 	if len(animes) == 0 {
 		return
 	}
-	c.log.Infof("[MAL] [Notify] got %d potential animes, applying filters...", len(animes))
+	c.log.Infof("[MAL] [Notify] got %d potential animes, applying filters of %d profile(s)...", len(animes), len(c.profiles))
+	// profiles share the user lists and images
+	userLists := make(map[string]userlist.List, len(c.profiles))
+	images := make(map[int]*notificationImage, len(animes))
+	for _, p := range c.profiles {
+		c.profileNotifier(p, animes, userLists, images)
+	}
+	// animes handled by every profile are not needed anymore, others are kept
+	// in order to have a chance to process them again later
+	c.update.Lock()
+	for _, anime := range animes {
+		if c.handledByAll(anime.MalID) {
+			c.dropAnime(anime.MalID, "handled by all profiles")
+		}
+	}
+	c.update.Unlock()
+}
+
+func (c *Controller) profileNotifier(p *profile, animes []*Anime, userLists map[string]userlist.List, images map[int]*notificationImage) {
 	// get user list if any
-	var userAnimes userlist.List
-	if c.user != "" {
-		var err error
-		if userAnimes, err = userlist.GetAllUserAnimes(c.user); err != nil {
-			c.log.Errorf("[MAL] [Notify] user list filtering: can't get '%s' animes list: %v",
-				c.user, err)
+	userAnimes, fetched := userLists[p.user]
+	if p.user == "" {
+		c.log.Debugf("[MAL] [Notify] [%s] user list filtering: user unset: skipping", p.name)
+	} else if !fetched {
+		err := c.retry(operationUserList, fmt.Sprintf("'%s' user list", p.user), func() (err error) {
+			userAnimes, err = userlist.GetAllUserAnimes(p.user)
+			return
+		})
+		if err != nil {
+			c.metrics.userListErrors.WithLabelValues(p.name).Inc()
+			c.log.Errorf("[MAL] [Notify] [%s] user list filtering: can't get '%s' animes list: %v",
+				p.name, p.user, err)
 		} else {
-			c.log.Infof("[MAL] [Notify] user list filtering: recovered %d anime(s) for user '%s'",
-				len(userAnimes), c.user)
+			c.log.Infof("[MAL] [Notify] [%s] user list filtering: recovered %d anime(s) for user '%s'",
+				p.name, len(userAnimes), p.user)
 		}
-	} else {
-		c.log.Debug("[MAL] [Notify] user list filtering: user unset: skipping")
+		userLists[p.user] = userAnimes
 	}
 	// process animes
+	notifs := make([]Notification, 0, len(animes))
 	for _, anime := range animes {
-		c.notify(anime, userAnimes)
-	}
-}
-
-func (c *Controller) notify(anime *jikan.Anime, userAnimes userlist.List) {
-	// filter out based on types
-	if bl := c.isBlacklistedType(anime); bl != "" {
-		c.log.Infof("[MAL] [Notify] '%s' (MalID %d) has a blacklisted type: %s: skipping",
-			getTitle(anime), anime.MalID, bl)
 		c.update.Lock()
-		delete(c.watchList, anime.MalID)
+		state := c.watchList[anime.MalID]
+		done := state != nil && state.Profiles[p.name] != nil && state.Profiles[p.name].Done
 		c.update.Unlock()
-		return
+		if done {
+			c.log.Debugf("[MAL] [Notify] [%s] '%s' (MalID %d) has already been handled: skipping",
+				p.name, getTitle(anime), anime.MalID)
+			continue
+		}
+		// the watch list may have been rebuilt since the anime was notified
+		if sent := c.alreadySent(p, anime.MalID); !sent.IsZero() {
+			c.log.Infof("[MAL] [Notify] [%s] '%s' (MalID %d) has already been notified on %v: skipping",
+				p.name, getTitle(anime), anime.MalID, sent.Format(time.RFC1123))
+			c.update.Lock()
+			if state != nil {
+				ps := state.profile(p.name)
+				ps.LastDecision = "already notified on " + sent.Format(time.RFC3339)
+				ps.Done = true
+				c.persistAnime(anime.MalID)
+			}
+			c.update.Unlock()
+			continue
+		}
+		if reasons, notify := c.filter(p, anime, userAnimes); notify {
+			notifs = append(notifs, c.generateNotification(p, anime, userAnimes, reasons, images))
+		}
 	}
-	// filter out based on genres
-	if bl := c.getBlacklistedGenres(anime); len(bl) > 0 {
-		c.log.Infof("[MAL] [Notify] '%s' (MalID %d) contains blacklisted genre(s): %s: skipping",
-			getTitle(anime), anime.MalID, strings.Join(bl, ", "))
+	// send them
+	c.deliver(p, notifs)
+}
+
+func (c *Controller) filter(p *profile, anime *Anime, userAnimes userlist.List) (reasons []string, notify bool) {
+	// filter out based on rules
+	decision := p.filters.evaluate(anime)
+	if !decision.notify {
+		// statistics may still evolve shortly after the end of airing
+		if decision.volatile && p.cooldown > 0 {
+			c.update.Lock()
+			state := c.watchList[anime.MalID]
+			var finishedAt time.Time
+			if state != nil {
+				finishedAt = state.FinishedAt
+			}
+			c.update.Unlock()
+			if state != nil {
+				if deadline := finishedAt.Add(p.cooldown); time.Now().Before(deadline) {
+					c.log.Infof("[MAL] [Notify] [%s] '%s' (MalID %d) filtered out by rule '%s': %s: score cool-down in progress, will be evaluated again until %v",
+						p.name, getTitle(anime), anime.MalID, decision.rule, strings.Join(decision.reasons, ", "), deadline.Format(time.RFC1123))
+					c.update.Lock()
+					if state = c.watchList[anime.MalID]; state != nil {
+						state.profile(p.name).LastDecision = "deferred: " + strings.Join(decision.reasons, ", ")
+						c.persistDecision(anime.MalID, p.name, getTitle(anime))
+					}
+					c.update.Unlock()
+					return
+				}
+				c.log.Debugf("[MAL] [Notify] [%s] '%s' (MalID %d) score cool-down is over since %v",
+					p.name, getTitle(anime), anime.MalID, finishedAt.Add(p.cooldown).Format(time.RFC1123))
+			}
+		}
+		c.log.Infof("[MAL] [Notify] [%s] '%s' (MalID %d) filtered out by rule '%s': %s: skipping",
+			p.name, getTitle(anime), anime.MalID, decision.rule, strings.Join(decision.reasons, ", "))
+		c.metrics.filtered.WithLabelValues(p.name, decision.rule).Inc()
 		c.update.Lock()
-		delete(c.watchList, anime.MalID)
+		if state := c.watchList[anime.MalID]; state != nil {
+			ps := state.profile(p.name)
+			ps.LastDecision = fmt.Sprintf("filtered by rule '%s': %s", decision.rule, strings.Join(decision.reasons, ", "))
+			ps.Done = true
+			c.persistDecision(anime.MalID, p.name, getTitle(anime))
+		}
 		c.update.Unlock()
 		return
 	}
-	// filter out based on score
-	if anime.Score < c.minScore {
-		c.log.Infof("[MAL] [Notify] '%s' (MalID %d) does not have the require score (%.2f/%.2f): skipping",
-			getTitle(anime), anime.MalID, anime.Score, c.minScore)
-		c.update.Lock()
-		delete(c.watchList, anime.MalID)
-		c.update.Unlock()
-		return
+	c.log.Debugf("[MAL] [Notify] [%s] '%s' (MalID %d) passed the filters thanks to rule '%s': %s",
+		p.name, getTitle(anime), anime.MalID, decision.rule, strings.Join(decision.reasons, ", "))
+	reasons = decision.reasons
+	c.update.Lock()
+	if state := c.watchList[anime.MalID]; state != nil {
+		state.profile(p.name).LastDecision = "notify: " + strings.Join(decision.reasons, ", ")
+		c.persistDecision(anime.MalID, p.name, getTitle(anime))
 	}
+	c.update.Unlock()
 	// filter out based on user list if any
 	if len(userAnimes) != 0 {
 		if animeUserList := userAnimes.Get(anime.MalID); animeUserList != nil {
 			if animeUserList.Status != userlist.StatusPlanToWatch {
-				c.log.Infof("[MAL] [Notify] '%s' (MalID %d) is already present on '%s' user list and is not marked as '%s': skipping",
-					getTitle(anime), anime.MalID, c.user, userlist.StatusPlanToWatch)
+				c.log.Infof("[MAL] [Notify] [%s] '%s' (MalID %d) is already present on '%s' user list and is not marked as '%s': skipping",
+					p.name, getTitle(anime), anime.MalID, p.user, userlist.StatusPlanToWatch)
+				c.metrics.filtered.WithLabelValues(p.name, filteredByUserList).Inc()
 				c.update.Lock()
-				delete(c.watchList, anime.MalID)
+				if state := c.watchList[anime.MalID]; state != nil {
+					ps := state.profile(p.name)
+					ps.LastDecision = fmt.Sprintf("filtered by user list: marked as '%s' on '%s' list", animeUserList.Status, p.user)
+					ps.Done = true
+					c.persistDecision(anime.MalID, p.name, getTitle(anime))
+				}
 				c.update.Unlock()
 				return
 			}
-			c.log.Debugf("[MAL] [Notify] '%s' (MalID %d) is present on '%s' user list and but is marked as '%s': keeping it for notification",
-				getTitle(anime), anime.MalID, c.user, userlist.StatusPlanToWatch)
+			c.log.Debugf("[MAL] [Notify] [%s] '%s' (MalID %d) is present on '%s' user list and but is marked as '%s': keeping it for notification",
+				p.name, getTitle(anime), anime.MalID, p.user, userlist.StatusPlanToWatch)
+			reasons = append(reasons, fmt.Sprintf("marked as '%s' on '%s' list", userlist.StatusPlanToWatch, p.user))
+		} else {
+			reasons = append(reasons, fmt.Sprintf("not present on '%s' list", p.user))
 		}
 	}
-	// send the notification
-	if err := c.pushover.SendCustomMsg(c.generateNotificationMsg(anime)); err != nil {
-		c.log.Errorf("[MAL] [Notify] '%s' (MalID %d) (%.2f/%.2f): pushover notification failed: %v",
-			getTitle(anime), anime.MalID, anime.Score, c.minScore, err)
-		// do not delete its status in order to have a chance to notify it again later
-	} else {
-		c.log.Infof("[MAL] [Notify] '%s' (MalID %d) (%.2f/%.2f): pushover notification sent",
-			getTitle(anime), anime.MalID, anime.Score, c.minScore)
-		// notification sent successfully, we can remove it from the state
-		c.update.Lock()
-		delete(c.watchList, anime.MalID)
-		c.update.Unlock()
-	}
+	notify = true
+	return
 }
 
-func (c *Controller) isBlacklistedType(anime *jikan.Anime) (blacklisted string) {
-	for _, blacklisted := range c.blTypes {
-		if anime.Type == blacklisted {
-			return blacklisted
+func (c *Controller) deliver(p *profile, notifs []Notification) {
+	if len(notifs) == 0 {
+		c.log.Infof("[MAL] [Notify] [%s] no anime passed the filters: nothing to send", p.name)
+		return
+	}
+	// send the notifications to every backend of the profile
+	delivered := make(map[int]int, len(notifs))
+	for _, notifier := range p.notifiers {
+		// some backends prefer to handle the whole batch at once
+		if batchNotifier, ok := notifier.(BatchNotifier); ok {
+			err := batchNotifier.NotifyBatch(c.ctx, notifs)
+			if err != nil {
+				c.log.Errorf("[MAL] [Notify] [%s] %s notification of %d anime(s) failed: %v",
+					p.name, notifier.Name(), len(notifs), err)
+			} else {
+				c.log.Infof("[MAL] [Notify] [%s] %s notification of %d anime(s) sent", p.name, notifier.Name(), len(notifs))
+			}
+			for _, notif := range notifs {
+				c.recordNotification(p, notif, notifier.Name(), err)
+				if err == nil {
+					delivered[notif.Anime.MalID]++
+				}
+			}
+			continue
+		}
+		// regular backend
+		for _, notif := range notifs {
+			err := notifier.Notify(c.ctx, notif)
+			c.recordNotification(p, notif, notifier.Name(), err)
+			if err != nil {
+				c.log.Errorf("[MAL] [Notify] [%s] '%s' (MalID %d) (%.2f/%.2f): %s notification failed: %v",
+					p.name, notif.Title, notif.Anime.MalID, notif.Anime.Score, p.minScore, notifier.Name(), err)
+			} else {
+				c.log.Infof("[MAL] [Notify] [%s] '%s' (MalID %d) (%.2f/%.2f): %s notification sent",
+					p.name, notif.Title, notif.Anime.MalID, notif.Anime.Score, p.minScore, notifier.Name())
+				delivered[notif.Anime.MalID]++
+			}
 		}
 	}
-	return
-}
-
-func (c *Controller) getBlacklistedGenres(anime *jikan.Anime) (matches []string) {
-	matches = make([]string, 0, len(c.blGenres))
-	for _, blacklisted := range c.blGenres {
-		for _, genre := range anime.Genres {
-			if genre.Name == blacklisted {
-				matches = append(matches, blacklisted)
+	// notifications sent successfully by at least one backend are done for this profile,
+	// others are kept in order to have a chance to notify them again later
+	c.update.Lock()
+	for _, notif := range notifs {
+		if delivered[notif.Anime.MalID] > 0 {
+			c.recordSent(p, notif.Anime.MalID, notif.Title)
+			if state := c.watchList[notif.Anime.MalID]; state != nil {
+				state.profile(p.name).Done = true
+				c.persistAnime(notif.Anime.MalID)
 			}
 		}
 	}
-	return
+	c.update.Unlock()
 }
 
-func (c *Controller) generateNotificationMsg(anime *jikan.Anime) pushover.Message {
-	// download the image
-	var attachment io.Reader
-	if anime.ImageURL != "" && anime.ImageURL != jikanFallbackImg {
-		var imgURL string
-		// we got something, does it follow the regular pattern ?
-		if imageRegex.MatchString(anime.ImageURL) {
-			// enlarge !
-			imgURL = strings.TrimSuffix(anime.ImageURL, ".jpg") + "l.jpg"
-			c.log.Debugf("[MAL] [Notify] large image url computed from '%s': %s",
-				anime.ImageURL, imgURL)
-		} else {
-			// too bad...
-			imgURL = anime.ImageURL
-			c.log.Debugf("[MAL] [Notify] can't compute large image URL: pattern does not match: %s",
-				anime.ImageURL)
-		}
-		// download the image and put it within the notification attachment reader
-		if imgData, err := getHTTPFile(imgURL); err != nil {
-			c.log.Errorf("[MAL] [Notify] can't download anime image: %v", err)
-		} else {
-			attachment = bytes.NewReader(imgData)
-		}
+func (c *Controller) recordNotification(p *profile, notif Notification, notifier string, err error) {
+	record := notificationRecord{
+		Date:     time.Now(),
+		Notifier: notifier,
+	}
+	if err != nil {
+		record.Error = err.Error()
 	}
-	// extract list names
-	studios := make([]string, len(anime.Studios))
-	for index, studioItem := range anime.Studios {
-		studios[index] = studioItem.Name
+	c.metrics.notification(p, notifier, err)
+	c.update.Lock()
+	if state := c.watchList[notif.Anime.MalID]; state != nil {
+		ps := state.profile(p.name)
+		ps.Notifications = append(ps.Notifications, record)
 	}
-	genres := make([]string, len(anime.Genres))
-	for index, genreItem := range anime.Genres {
-		genres[index] = genreItem.Name
+	if err := c.store.recordNotification(notif.Anime.MalID, p.name, notif.Title, record); err != nil {
+		c.log.Errorf("[MAL] [Store] can't record '%s' (MalID %d) %s notification for profile '%s': %v",
+			notif.Title, notif.Anime.MalID, notifier, p.name, err)
+	}
+	c.update.Unlock()
+}
+
+// notificationImage is the large image of an anime, downloaded once for all the profiles
+type notificationImage struct {
+	url  string
+	data []byte
+}
+
+func (c *Controller) getNotificationImage(anime *Anime, images map[int]*notificationImage) (image *notificationImage) {
+	if image = images[anime.MalID]; image != nil {
+		return
+	}
+	image = new(notificationImage)
+	images[anime.MalID] = image
+	if anime.ImageURL == "" || anime.ImageURL == malFallbackImg {
+		return
+	}
+	// sources already provide their largest image
+	image.url = anime.ImageURL
+	// download the image and put it within the notification for the backends sending attachments
+	var err error
+	if image.data, err = c.getHTTPFile(image.url); err != nil {
+		c.log.Errorf("[MAL] [Notify] can't download anime image: %v", err)
+	}
+	return
+}
+
+func (c *Controller) generateNotification(p *profile, anime *Anime, userAnimes userlist.List, reasons []string,
+	images map[int]*notificationImage) (notif Notification) {
+	// get the image
+	image := c.getNotificationImage(anime, images)
+	notif.ImageURL = image.url
+	notif.Image = image.data
+	// prepare the templates data
+	data := TemplateData{
+		Anime:         anime,
+		Title:         getTitle(anime),
+		LargeImageURL: notif.ImageURL,
+		Studios:       anime.Studios,
+		Genres:        anime.Genres,
+		FilterReasons: reasons,
+		Profile:       p.name,
+	}
+	if animeUserList := userAnimes.Get(anime.MalID); animeUserList != nil {
+		data.UserListStatus = animeUserList.Status.String()
 	}
 	// choose the right timestamp
-	var timestamp int64
 	if !anime.Aired.To.IsZero() {
-		timestamp = anime.Aired.To.Unix()
+		notif.Timestamp = anime.Aired.To
 	} else {
-		timestamp = anime.Aired.From.Unix()
-	}
-	// return the msg
-	return pushover.Message{
-		Message: fmt.Sprintf("<b>Score</b>\n%.2f (%d votes) ranked #%d\n<b>Episodes</b>\n%d %s (%s)\n<b>Studios</b>\n%s\n<b>Genres</b>\n%s\n<b>Rating</b>\n%s",
-			anime.Score, anime.ScoredBy, anime.Rank,
-			anime.Episodes, anime.Type, anime.Duration,
-			strings.Join(studios, ", "),
-			strings.Join(genres, ", "),
-			anime.Rating,
-		),
-		Title:      getTitle(anime),
-		Priority:   pushover.PriorityNormal,
-		URL:        anime.URL,
-		URLTitle:   "Check it on MyAnimeList",
-		Timestamp:  timestamp,
-		HTML:       true,
-		Attachment: attachment,
+		notif.Timestamp = anime.Aired.From
 	}
+	// finish the notification
+	var err error
+	if notif.Title, notif.Message, notif.URLTitle, err = p.templates.render(data); err != nil {
+		c.log.Errorf("[MAL] [Notify] [%s] '%s' (MalID %d): can't render notification with user templates, using default ones: %v",
+			p.name, data.Title, anime.MalID, err)
+		notif.Title, notif.Message, notif.URLTitle, _ = defaultTemplates.render(data)
+	}
+	notif.URL = anime.URL
+	notif.Anime = anime
+	return
 }
 
-func getHTTPFile(url string) (file []byte, err error) {
-	response, err := http.Get(url)
+func (c *Controller) getHTTPFile(url string) (file []byte, err error) {
+	response, err := c.httpClient.Get(url)
 	if err != nil {
 		return
 	}
@@ -196,7 +316,7 @@ func getHTTPFile(url string) (file []byte, err error) {
 	return ioutil.ReadAll(response.Body)
 }
 
-func getTitle(anime *jikan.Anime) string {
+func getTitle(anime *Anime) string {
 	if anime.TitleEnglish != "" {
 		return anime.TitleEnglish
 	}
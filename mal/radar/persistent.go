@@ -4,7 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/hekmon/hllogger"
 )
 
 const (
@@ -12,56 +18,285 @@ const (
 	genresFile  = "encountered_genres.json"
 	ratingsFile = "encountered_ratings.json"
 	typesFile   = "encountered_types.json"
+	// backupSuffix is appended to the files name to store their previous version
+	backupSuffix = ".bak"
+	// importedSuffix is appended to the files name once imported into another backend
+	importedSuffix = ".imported"
+)
+
+const (
+	// stateVersion is the current version of the state file schema:
+	// 0: bare map of MalID -> status string
+	// 1: versioned document with full per anime records
+	stateVersion = 1
 )
 
-func (c *Controller) load(file string) (proceed bool) {
+// stateDocument is the content of the state file
+type stateDocument struct {
+	Version int                 `json:"version"`
+	Animes  map[int]*animeState `json:"animes"`
+	// migratedFrom is the version of the file when it was loaded
+	migratedFrom int
+}
+
+// UnmarshalJSON loads any known version of the state file and migrates it to the current schema
+func (sd *stateDocument) UnmarshalJSON(data []byte) (err error) {
+	// legacy versions were bare maps without any version field
+	var probe struct {
+		Version int `json:"version"`
+	}
+	if err = json.Unmarshal(data, &probe); err != nil {
+		return fmt.Errorf("unknown state format: %w", err)
+	}
+	switch probe.Version {
+	case 0:
+		var legacy map[int]string
+		if err = json.Unmarshal(data, &legacy); err != nil {
+			return fmt.Errorf("can't decode legacy state: %w", err)
+		}
+		sd.migrateLegacy(legacy)
+		return
+	case stateVersion:
+		type alias stateDocument
+		if err = json.Unmarshal(data, (*alias)(sd)); err != nil {
+			return
+		}
+		sd.migratedFrom = stateVersion
+		return
+	default:
+		return fmt.Errorf("unsupported state version %d (current version is %d)", probe.Version, stateVersion)
+	}
+}
+
+// migrateLegacy converts the version 0 map of statuses to the current schema
+func (sd *stateDocument) migrateLegacy(legacy map[int]string) {
+	sd.Version = stateVersion
+	sd.Animes = make(map[int]*animeState, len(legacy))
+	for malID, status := range legacy {
+		sd.Animes[malID] = &animeState{Status: status}
+	}
+	sd.migratedFrom = 0
+}
+
+// animeState is the tracking record of an anime within the watch list
+type animeState struct {
+	Title       string                   `json:"title"`
+	Status      string                   `json:"status"`
+	FirstSeen   time.Time                `json:"first_seen"`
+	LastChecked time.Time                `json:"last_checked"`
+	LastScore   float64                  `json:"last_score"`
+	Failures    int                      `json:"failures"`
+	FinishedAt  time.Time                `json:"finished_at"`
+	ImageURL    string                   `json:"image_url,omitempty"`
+	Profiles    map[string]*profileState `json:"profiles,omitempty"`
+	// details are the last fetched details, only kept in memory
+	details *Anime
+}
+
+// notificationRecord keeps track of a notification attempt
+type notificationRecord struct {
+	Date     time.Time `json:"date"`
+	Notifier string    `json:"notifier"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// newAnimeState returns the tracking record of a freshly fetched anime
+func newAnimeState(anime *Anime) (state *animeState) {
+	state = &animeState{
+		FirstSeen: time.Now(),
+	}
+	state.refresh(anime)
+	if anime.Status == animeStatusFinished {
+		state.setFinished(anime)
+	} else {
+		state.Status = anime.Status
+	}
+	return
+}
+
+// refresh updates the record with freshly fetched details (status excepted)
+func (as *animeState) refresh(anime *Anime) {
+	as.Title = getTitle(anime)
+	as.LastChecked = time.Now()
+	as.LastScore = anime.Score
+	as.Failures = 0
+	as.ImageURL = anime.ImageURL
+	as.details = anime
+}
+
+// setFinished marks the record as finished, using the end of airing date as finish time if available
+func (as *animeState) setFinished(anime *Anime) {
+	as.Status = animeStatusFinished
+	if !anime.Aired.To.IsZero() {
+		as.FinishedAt = anime.Aired.To
+	} else {
+		as.FinishedAt = time.Now()
+	}
+}
+
+// jsonStore is the historical storage backend: a JSON file per state element within the state directory.
+// The whole state is dumped at each save, history is only kept within the animes records.
+type jsonStore struct {
+	dir string
+	// sent is the sent notifications ledger, written to its own file at each change
+	sent map[ledgerKey]ledgerEntry
+	log  *hllogger.HlLogger
+}
+
+func newJSONStore(dir string, logger *hllogger.HlLogger) *jsonStore {
+	return &jsonStore{
+		dir: dir,
+		log: logger,
+	}
+}
+
+func (js *jsonStore) name() string {
+	return StorageJSON
+}
+
+func (js *jsonStore) load() (state storeState, err error) {
+	if !js.loadFile(stateFile, &state) {
+		err = errors.New("can't load the animes state")
+		return
+	}
+	// encountered values are not critical
+	js.loadFile(genresFile, &state)
+	js.loadFile(ratingsFile, &state)
+	js.loadFile(typesFile, &state)
+	// sent notifications must be known to avoid notifying again
+	if err = js.loadLedger(); err != nil {
+		err = fmt.Errorf("can't load the sent notifications ledger: %w", err)
+	}
+	return
+}
+
+func (js *jsonStore) save(state storeState) (err error) {
+	failed := 0
+	for _, file := range []string{stateFile, genresFile, ratingsFile, typesFile} {
+		if !js.saveFile(file, state) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		err = fmt.Errorf("%d file(s) could not be saved", failed)
+	}
+	return
+}
+
+// markImported renames the state files and their backups once imported into another backend
+// to prevent them from being imported again
+func (js *jsonStore) markImported() (err error) {
+	for _, file := range []string{stateFile, genresFile, ratingsFile, typesFile, ledgerFile} {
+		for _, path := range []string{filepath.Join(js.dir, file), filepath.Join(js.dir, file+backupSuffix)} {
+			if err = os.Rename(path, path+importedSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return
+			}
+		}
+	}
+	return nil
+}
+
+// the json store dumps everything at save: incremental updates are not needed and history is not kept
+
+func (js *jsonStore) saveAnime(malID int, state *animeState) error {
+	return nil
+}
+
+func (js *jsonStore) deleteAnime(malID int, reason string) error {
+	return nil
+}
+
+func (js *jsonStore) recordTransition(malID int, title, from, to string) error {
+	return nil
+}
+
+func (js *jsonStore) recordDecision(malID int, profile, title, decision string) error {
+	return nil
+}
+
+func (js *jsonStore) recordNotification(malID int, profile, title string, record notificationRecord) error {
+	return nil
+}
+
+func (js *jsonStore) close() error {
+	return nil
+}
+
+func (js *jsonStore) loadFile(file string, target *storeState) (proceed bool) {
 	// prepare
 	var (
-		log    string
-		target interface{}
+		log   string
+		state stateDocument
+		reset func() interface{}
 	)
 	switch file {
 	case stateFile:
 		log = "state"
 		// do not make the map here as nil is used to start the initial building
-		target = &c.watchList
+		reset = func() interface{} {
+			state = stateDocument{}
+			return &state
+		}
 	case genresFile:
 		log = "genres"
-		c.genres = make(UniqList)
-		target = &c.genres
+		reset = func() interface{} {
+			target.genres = make(UniqList)
+			return &target.genres
+		}
 	case ratingsFile:
 		log = "ratings"
-		c.ratings = make(UniqList)
-		target = &c.ratings
+		reset = func() interface{} {
+			target.ratings = make(UniqList)
+			return &target.ratings
+		}
 	case typesFile:
 		log = "types"
-		c.types = make(UniqList)
-		target = &c.types
+		reset = func() interface{} {
+			target.types = make(UniqList)
+			return &target.types
+		}
 	default:
 		panic(fmt.Sprintf("persistent save received an unknown file: %s", file))
 	}
-	// handle file descriptor
-	fd, err := os.Open(file)
+	// try the main file first
+	path := filepath.Join(js.dir, file)
+	loadedFrom := path
+	err := decodeFile(path, reset())
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			proceed = true
+			js.log.Debugf("[MAL] %s file %s does not exist: checking for a backup", log, path)
 		} else {
-			c.log.Errorf("[MAL] can't open %s file: %v", log, err)
+			js.log.Errorf("[MAL] can't load %s file: %v: trying backup", log, err)
 		}
-		return
+		// then its backup
+		loadedFrom = path + backupSuffix
+		if errBackup := decodeFile(loadedFrom, reset()); errBackup != nil {
+			reset()
+			if errors.Is(errBackup, os.ErrNotExist) {
+				// no usable backup: only proceed if the main file did not exist either
+				proceed = errors.Is(err, os.ErrNotExist)
+				if !proceed {
+					js.log.Errorf("[MAL] can't load %s: no backup available", log)
+				}
+			} else {
+				js.log.Errorf("[MAL] can't load %s backup file: %v", log, errBackup)
+			}
+			return
+		}
+		js.log.Warningf("[MAL] %s recovered from backup file %s", log, loadedFrom)
 	}
-	defer fd.Close()
-	// handle content
-	if err = json.NewDecoder(fd).Decode(target); err != nil {
-		c.log.Errorf("[MAL] can't parse %s file: %v", log, err)
-		return
+	if file == stateFile {
+		target.watchList = state.Animes
+		if state.migratedFrom != stateVersion {
+			js.log.Infof("[MAL] state migrated from version %d to version %d", state.migratedFrom, stateVersion)
+		}
 	}
-	c.log.Infof("[MAL] %s loaded from %s", log, file)
+	js.log.Infof("[MAL] %s loaded from %s", log, loadedFrom)
 	proceed = true
 	return
 }
 
-func (c *Controller) save(file string) {
+func (js *jsonStore) saveFile(file string, target storeState) (saved bool) {
 	// prepare
 	var (
 		log    string
@@ -69,36 +304,247 @@ func (c *Controller) save(file string) {
 	)
 	switch file {
 	case stateFile:
-		if len(c.watchList) == 0 {
+		if len(target.watchList) == 0 {
 			// next run will need to build the initial list
-			c.log.Debug("[MAL] saving state skipped: next start must initial list building")
-			return
+			js.log.Debug("[MAL] saving state skipped: next start must initial list building")
+			return true
 		}
 		log = "state"
-		source = c.watchList
+		source = stateDocument{
+			Version: stateVersion,
+			Animes:  target.watchList,
+		}
 	case genresFile:
 		log = "genres"
-		source = c.genres
+		source = target.genres
 	case ratingsFile:
 		log = "ratings"
-		source = c.ratings
+		source = target.ratings
 	case typesFile:
 		log = "types"
-		source = c.types
+		source = target.types
 	default:
 		panic(fmt.Sprintf("persistent load received an unknown file: %s", file))
 	}
-	// handle file descriptor
-	fd, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	// handle content
+	path := filepath.Join(js.dir, file)
+	if err := encodeFileAtomic(path, source); err != nil {
+		js.log.Errorf("[MAL] can't write %s to file: %v", log, err)
+		return
+	}
+	js.log.Infof("[MAL] %s saved to %s", log, path)
+	return true
+}
+
+func (js *jsonStore) loadCheckpoint() (checkpoint *buildCheckpoint, err error) {
+	path := filepath.Join(js.dir, checkpointFile)
+	if err = decodeFile(path, &checkpoint); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		js.log.Errorf("[MAL] can't load checkpoint file: %v: trying backup", err)
+		if errBackup := decodeFile(path+backupSuffix, &checkpoint); errBackup != nil {
+			return nil, err
+		}
+		err = nil
+	}
+	return
+}
+
+func (js *jsonStore) saveCheckpoint(checkpoint *buildCheckpoint) error {
+	return encodeFileAtomic(filepath.Join(js.dir, checkpointFile), checkpoint)
+}
+
+func (js *jsonStore) clearCheckpoint() (err error) {
+	path := filepath.Join(js.dir, checkpointFile)
+	for _, file := range []string{path, path + backupSuffix} {
+		if err = os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+	}
+	return nil
+}
+
+func (js *jsonStore) loadLedger() (err error) {
+	var ledger ledgerDocument
+	// try the main file first
+	path := filepath.Join(js.dir, ledgerFile)
+	loadedFrom := path
+	if err = decodeLedger(path, &ledger); err != nil {
+		notExist := errors.Is(err, os.ErrNotExist)
+		if !notExist {
+			js.log.Errorf("[MAL] can't load sent notifications ledger file: %v: trying backup", err)
+		}
+		// then its backup
+		loadedFrom = path + backupSuffix
+		ledger = ledgerDocument{}
+		if errBackup := decodeLedger(loadedFrom, &ledger); errBackup != nil {
+			if errors.Is(errBackup, os.ErrNotExist) {
+				if notExist {
+					// first start
+					js.sent = make(map[ledgerKey]ledgerEntry)
+					return nil
+				}
+				return fmt.Errorf("%w: no backup available", err)
+			}
+			return fmt.Errorf("%v: backup: %w", err, errBackup)
+		}
+		js.log.Warningf("[MAL] sent notifications ledger recovered from backup file %s", loadedFrom)
+	}
+	js.sent = make(map[ledgerKey]ledgerEntry, len(ledger.Sent))
+	for _, entry := range ledger.Sent {
+		js.sent[ledgerKey{MalID: entry.MalID, Profile: entry.Profile}] = entry
+	}
+	js.log.Infof("[MAL] sent notifications ledger loaded from %s: %d entrie(s)", loadedFrom, len(js.sent))
+	return nil
+}
+
+// decodeLedger loads a ledger file and checks its version
+func decodeLedger(path string, ledger *ledgerDocument) (err error) {
+	if err = decodeFile(path, ledger); err != nil {
+		return
+	}
+	if ledger.Version != ledgerVersion {
+		return fmt.Errorf("%s: unsupported ledger version %d (current version is %d)", path, ledger.Version, ledgerVersion)
+	}
+	return
+}
+
+func (js *jsonStore) sentNotification(malID int, profile string) (date time.Time, err error) {
+	return js.sent[ledgerKey{MalID: malID, Profile: profile}].Date, nil
+}
+
+func (js *jsonStore) recordSent(entry ledgerEntry) (err error) {
+	if js.sent == nil {
+		js.sent = make(map[ledgerKey]ledgerEntry)
+	}
+	key := ledgerKey{MalID: entry.MalID, Profile: entry.Profile}
+	if _, found := js.sent[key]; found {
+		// keep the first notification date
+		return
+	}
+	js.sent[key] = entry
+	ledger := ledgerDocument{
+		Version: ledgerVersion,
+		Sent:    make([]ledgerEntry, 0, len(js.sent)),
+	}
+	for _, entry := range js.sent {
+		ledger.Sent = append(ledger.Sent, entry)
+	}
+	sort.Slice(ledger.Sent, func(i, j int) bool {
+		return ledger.Sent[i].Date.Before(ledger.Sent[j].Date)
+	})
+	return encodeFileAtomic(filepath.Join(js.dir, ledgerFile), ledger)
+}
+
+func (js *jsonStore) loadSchedule() (state scheduleState, err error) {
+	if err = decodeFile(filepath.Join(js.dir, scheduleFile), &state); errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return
+}
+
+func (js *jsonStore) saveSchedule(state scheduleState) error {
+	return encodeFileAtomic(filepath.Join(js.dir, scheduleFile), state)
+}
+
+// recentNotifications only knows the successful notifications thru the ledger: failed attempts are not kept
+// once the anime has left the watch list.
+func (js *jsonStore) recentNotifications(limit int) (notifications []NotificationLog, err error) {
+	notifications = make([]NotificationLog, 0, len(js.sent))
+	for _, entry := range js.sent {
+		notifications = append(notifications, NotificationLog{
+			MalID:   entry.MalID,
+			Profile: entry.Profile,
+			Title:   entry.Title,
+			Date:    entry.Date,
+		})
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].Date.After(notifications[j].Date)
+	})
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	return
+}
+
+// checkStateDir makes sure dir exists (creating it if needed) and is writable
+func checkStateDir(dir string) (err error) {
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("can't create state directory: %w", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("can't stat state directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("state directory %s is not a directory", dir)
+	}
+	// permissions bits are not enough (ownership, ACLs, read only mount, etc...): just try
+	probe, err := ioutil.TempFile(dir, ".malradar_probe_*")
+	if err != nil {
+		return fmt.Errorf("state directory is not writable: %w", err)
+	}
+	probe.Close()
+	if err = os.Remove(probe.Name()); err != nil {
+		return fmt.Errorf("can't remove write probe file from state directory: %w", err)
+	}
+	return
+}
+
+func decodeFile(file string, target interface{}) (err error) {
+	fd, err := os.Open(file)
 	if err != nil {
-		c.log.Errorf("[MAL] can't open %s file: %v", log, err)
 		return
 	}
 	defer fd.Close()
-	// handle content
+	if err = json.NewDecoder(fd).Decode(target); err != nil {
+		err = fmt.Errorf("can't parse %s: %w", file, err)
+	}
+	return
+}
+
+// encodeFileAtomic writes source to a temporary file synced to disk before replacing file with it.
+// The previous version of file is kept as a backup.
+func encodeFileAtomic(file string, source interface{}) (err error) {
+	// write the temporary file
+	fd, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("can't create temporary file: %w", err)
+	}
+	tmpFile := fd.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmpFile)
+		}
+	}()
 	if err = json.NewEncoder(fd).Encode(source); err != nil {
-		c.log.Errorf("[MAL] can't write %s to file: %v", log, err)
-		return
+		fd.Close()
+		return fmt.Errorf("can't encode content to %s: %w", tmpFile, err)
+	}
+	if err = fd.Sync(); err != nil {
+		fd.Close()
+		return fmt.Errorf("can't sync %s: %w", tmpFile, err)
+	}
+	if err = fd.Close(); err != nil {
+		return fmt.Errorf("can't close %s: %w", tmpFile, err)
 	}
-	c.log.Infof("[MAL] %s saved to %s", log, file)
+	if err = os.Chmod(tmpFile, 0640); err != nil {
+		return fmt.Errorf("can't set %s permissions: %w", tmpFile, err)
+	}
+	// rotate the current file as backup
+	if err = os.Rename(file, file+backupSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("can't rotate %s as backup: %w", file, err)
+	}
+	// put the new file in place
+	if err = os.Rename(tmpFile, file); err != nil {
+		return fmt.Errorf("can't rename %s to %s: %w", tmpFile, file, err)
+	}
+	// make sure the renames are persisted
+	if dir, errDir := os.Open(filepath.Dir(file)); errDir == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return
 }
@@ -0,0 +1,132 @@
+package radar
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hekmon/hllogger"
+)
+
+func TestStateDocumentLegacyMigration(t *testing.T) {
+	var sd stateDocument
+	if err := json.Unmarshal([]byte(`{"5114": "Finished Airing", "38524": "Currently Airing"}`), &sd); err != nil {
+		t.Fatalf("can't load legacy state: %v", err)
+	}
+	if sd.Version != stateVersion || sd.migratedFrom != 0 {
+		t.Errorf("unexpected version %d (migrated from %d)", sd.Version, sd.migratedFrom)
+	}
+	if len(sd.Animes) != 2 || sd.Animes[5114].Status != animeStatusFinished || sd.Animes[38524].Status != animeStatusOnGoing {
+		t.Errorf("unexpected migrated animes: %+v", sd.Animes)
+	}
+}
+
+func TestStateDocumentCurrentVersion(t *testing.T) {
+	data, err := json.Marshal(stateDocument{
+		Version: stateVersion,
+		Animes:  map[int]*animeState{5114: {Title: "Fullmetal Alchemist: Brotherhood", Status: animeStatusFinished}},
+	})
+	if err != nil {
+		t.Fatalf("can't marshal state: %v", err)
+	}
+	var sd stateDocument
+	if err = json.Unmarshal(data, &sd); err != nil {
+		t.Fatalf("can't load state: %v", err)
+	}
+	if sd.migratedFrom != stateVersion || sd.Animes[5114] == nil || sd.Animes[5114].Title != "Fullmetal Alchemist: Brotherhood" {
+		t.Errorf("unexpected state: %+v", sd)
+	}
+	if err = json.Unmarshal([]byte(`{"version": 2, "animes": {}}`), &sd); err == nil {
+		t.Error("an unknown state version must be rejected")
+	}
+}
+
+func TestLegacyImportOnce(t *testing.T) {
+	dir := t.TempDir()
+	logger := hllogger.New(io.Discard, &hllogger.Config{LogLevel: hllogger.Fatal})
+	// previous json installation
+	legacy := newJSONStore(dir, logger)
+	err := legacy.save(storeState{
+		watchList: map[int]*animeState{5114: {Title: "Fullmetal Alchemist: Brotherhood", Status: animeStatusOnGoing}},
+	})
+	if err != nil {
+		t.Fatalf("can't save the json state: %v", err)
+	}
+	if err = legacy.recordSent(ledgerEntry{MalID: 1, Profile: DefaultProfile, Title: "Cowboy Bebop", Date: time.Now()}); err != nil {
+		t.Fatalf("can't record the sent notification: %v", err)
+	}
+	load := func(dbFile string) *Controller {
+		t.Helper()
+		store, err := newSQLiteStore(filepath.Join(dir, dbFile), logger)
+		if err != nil {
+			t.Fatalf("can't open the sqlite store: %v", err)
+		}
+		t.Cleanup(func() { store.close() })
+		c := &Controller{stateDir: dir, store: store, log: logger}
+		if !c.load() {
+			t.Fatal("can't load the state")
+		}
+		return c
+	}
+	c := load("first.db")
+	if len(c.watchList) != 1 || c.watchList[5114] == nil {
+		t.Errorf("the json watch list has not been imported: %v", c.watchList)
+	}
+	if date, _ := c.store.sentNotification(1, DefaultProfile); date.IsZero() {
+		t.Error("the json ledger has not been imported")
+	}
+	for _, file := range []string{stateFile, ledgerFile} {
+		if _, err = os.Stat(filepath.Join(dir, file)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s should have been renamed: %v", file, err)
+		}
+		if _, err = os.Stat(filepath.Join(dir, file+importedSuffix)); err != nil {
+			t.Errorf("%s should have been renamed: %v", file, err)
+		}
+	}
+	// an empty database must not import the previous json state again
+	if c = load("second.db"); c.watchList != nil {
+		t.Errorf("the json state has been imported again: %v", c.watchList)
+	}
+}
+
+func TestLedgerBackupRecovery(t *testing.T) {
+	logger := hllogger.New(io.Discard, &hllogger.Config{LogLevel: hllogger.Fatal})
+	backup := `{"version": 1, "sent": [{"mal_id": 5114, "profile": "default", "title": "Fullmetal Alchemist: Brotherhood", "date": "2024-01-01T00:00:00Z"}]}`
+	for name, tc := range map[string]struct {
+		main, backup string
+		recovered    bool
+	}{
+		"corrupt":       {main: `{"version": 1, "sent": [`, backup: backup, recovered: true},
+		"wrong version": {main: `{"version": 99, "sent": []}`, backup: backup, recovered: true},
+		"no backup":     {main: `{"version": 99, "sent": []}`},
+		"both corrupt":  {main: `{"version": 1, "sent": [`, backup: `{`},
+	} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, ledgerFile)
+		if err := os.WriteFile(path, []byte(tc.main), 0o600); err != nil {
+			t.Fatalf("can't write the ledger: %v", err)
+		}
+		if tc.backup != "" {
+			if err := os.WriteFile(path+backupSuffix, []byte(tc.backup), 0o600); err != nil {
+				t.Fatalf("can't write the ledger backup: %v", err)
+			}
+		}
+		js := newJSONStore(dir, logger)
+		err := js.loadLedger()
+		if !tc.recovered {
+			if err == nil {
+				t.Errorf("%s: an unusable ledger must be reported", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: the ledger should have been recovered from its backup: %v", name, err)
+		} else if date, _ := js.sentNotification(5114, DefaultProfile); date.IsZero() {
+			t.Errorf("%s: the backup entries have not been loaded", name)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package radar
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultProfile is the name of the profile used when no named profiles are configured
+	DefaultProfile = "default"
+)
+
+// ProfileConfig holds the filters, MAL user and notification targets of a watch profile.
+// All the profiles share the same watch list.
+type ProfileConfig struct {
+	Name                string
+	MinScore            float64
+	MinScoredBy         int
+	MinMembers          int
+	MaxRank             int
+	MaxPopularity       int
+	User                string
+	GenresBlacklist     []string
+	TypesBlacklist      []string
+	GenresWhitelist     []string
+	GenresWhitelistMode string
+	Filters             []FilterRule
+	FiltersDefault      FilterAction
+	ScoreCooldown       time.Duration
+	Notifiers           []Notifier
+	Templates           *Templates
+}
+
+type profile struct {
+	name      string
+	minScore  float64
+	user      string
+	filters   *filters
+	cooldown  time.Duration
+	notifiers []Notifier
+	templates *Templates
+}
+
+func newProfile(conf ProfileConfig) (p *profile, err error) {
+	if conf.Name == "" {
+		return nil, errors.New("profile name can't be empty")
+	}
+	if len(conf.Notifiers) == 0 {
+		return nil, fmt.Errorf("profile '%s' has no notifiers", conf.Name)
+	}
+	if conf.Templates == nil {
+		conf.Templates = defaultTemplates
+	}
+	legacyRules, err := legacyFilterRules(conf)
+	if err != nil {
+		return nil, fmt.Errorf("profile '%s': invalid filters configuration: %w", conf.Name, err)
+	}
+	// the user rules come first: an allow rule can then override the legacy blacklists and thresholds
+	rules := make([]FilterRule, 0, len(conf.Filters)+len(legacyRules))
+	rules = append(rules, conf.Filters...)
+	filters, err := newFilters(append(rules, legacyRules...), conf.FiltersDefault)
+	if err != nil {
+		return nil, fmt.Errorf("profile '%s': invalid filters configuration: %w", conf.Name, err)
+	}
+	return &profile{
+		name:      conf.Name,
+		minScore:  conf.MinScore,
+		user:      conf.User,
+		filters:   filters,
+		cooldown:  conf.ScoreCooldown,
+		notifiers: conf.Notifiers,
+		templates: conf.Templates,
+	}, nil
+}
+
+// profileState is the processing state of a finished anime for a given profile
+type profileState struct {
+	LastDecision  string               `json:"last_decision,omitempty"`
+	Notifications []notificationRecord `json:"notifications,omitempty"`
+	// Done is set once the profile does not need the anime anymore (notified or filtered out)
+	Done bool `json:"done,omitempty"`
+}
+
+// profile returns the state of the anime for the profile name, creating it if needed
+func (as *animeState) profile(name string) (ps *profileState) {
+	if as.Profiles == nil {
+		as.Profiles = make(map[string]*profileState)
+	}
+	if ps = as.Profiles[name]; ps == nil {
+		ps = new(profileState)
+		as.Profiles[name] = ps
+	}
+	return
+}
+
+// handledByAll returns true if every configured profile is done with the anime.
+// c.update must be held by the caller.
+func (c *Controller) handledByAll(malID int) bool {
+	state := c.watchList[malID]
+	if state == nil {
+		return false
+	}
+	for _, p := range c.profiles {
+		if ps := state.Profiles[p.name]; ps == nil || !ps.Done {
+			return false
+		}
+	}
+	return true
+}
@@ -1,34 +1,206 @@
 package radar
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
 	"time"
+
+	"github.com/hekmon/hllogger"
 )
 
 const (
-	jikkanRateLimit = 2 * time.Second
+	// defaults follow the Jikan API limits
+	defaultRateLimitPerSecond = 3
+	defaultRateLimitPerMinute = 60
+	httpTimeout               = 60 * time.Second
 )
 
-func (c *Controller) rateLimiter() {
-	if c.lastRequest.IsZero() {
-		c.log.Debug("[MAL] [RateLimiter] first request")
-		c.lastRequest = time.Now()
+// RateLimitConfig defines the requests budgets shared by every HTTP call made to MyAnimeList and Jikan
+type RateLimitConfig struct {
+	PerSecond int `json:"per_second"`
+	PerMinute int `json:"per_minute"`
+}
+
+// bucket is a token bucket refilled continuously at capacity tokens per interval
+type bucket struct {
+	capacity float64
+	rate     float64 // tokens per second
+	tokens   float64
+}
+
+func newBucket(capacity int, interval time.Duration) *bucket {
+	return &bucket{
+		capacity: float64(capacity),
+		rate:     float64(capacity) / interval.Seconds(),
+		tokens:   float64(capacity),
+	}
+}
+
+func (b *bucket) refill(elapsed time.Duration) {
+	if b.tokens += elapsed.Seconds() * b.rate; b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// missing returns the time needed to get a full token
+func (b *bucket) missing() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// rateLimiter is a concurrency safe limiter enforcing several token buckets at once.
+// Waits are aborted when ctx is done.
+type rateLimiter struct {
+	ctx     context.Context
+	access  sync.Mutex
+	buckets []*bucket
+	last    time.Time
+	// blockedUntil is set when the server asked us to slow down
+	blockedUntil time.Time
+	metrics      *metrics
+	log          *hllogger.HlLogger
+}
+
+func newRateLimiter(ctx context.Context, conf RateLimitConfig, m *metrics, logger *hllogger.HlLogger) (rl *rateLimiter, err error) {
+	if conf.PerSecond == 0 {
+		conf.PerSecond = defaultRateLimitPerSecond
+	}
+	if conf.PerMinute == 0 {
+		conf.PerMinute = defaultRateLimitPerMinute
+	}
+	if conf.PerSecond < 0 || conf.PerMinute < 0 {
+		return nil, fmt.Errorf("budgets can't be negative (per second: %d, per minute: %d)", conf.PerSecond, conf.PerMinute)
+	}
+	return &rateLimiter{
+		ctx: ctx,
+		buckets: []*bucket{
+			newBucket(conf.PerSecond, time.Second),
+			newBucket(conf.PerMinute, time.Minute),
+		},
+		last:    time.Now(),
+		metrics: m,
+		log:     logger,
+	}, nil
+}
+
+func (rl *rateLimiter) String() string {
+	return fmt.Sprintf("%.0f request(s) per second and %.0f request(s) per minute", rl.buckets[0].capacity, rl.buckets[1].capacity)
+}
+
+// wait blocks until a request can be sent or ctx (or the limiter one) is done
+func (rl *rateLimiter) wait(ctx context.Context) (err error) {
+	start := time.Now()
+	defer observeSince(rl.metrics.limiterWait, start)
+	for {
+		delay := rl.take()
+		if delay == 0 {
+			return
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-rl.ctx.Done():
+			timer.Stop()
+			return rl.ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// take consumes a token of each bucket if all of them have one, otherwise it returns the delay to wait before trying again
+func (rl *rateLimiter) take() (delay time.Duration) {
+	rl.access.Lock()
+	defer rl.access.Unlock()
+	now := time.Now()
+	if now.Before(rl.blockedUntil) {
+		return rl.blockedUntil.Sub(now)
+	}
+	elapsed := now.Sub(rl.last)
+	rl.last = now
+	for _, b := range rl.buckets {
+		b.refill(elapsed)
+		if missing := b.missing(); missing > delay {
+			delay = missing
+		}
+	}
+	if delay > 0 {
 		return
 	}
-	dur := time.Since(c.lastRequest)
-	if dur > jikkanRateLimit {
-		c.log.Debugf("[MAL] [RateLimiter] last request was %v ago: do not wait", dur)
-		c.lastRequest = time.Now()
+	for _, b := range rl.buckets {
+		b.tokens--
+	}
+	return
+}
+
+// slowDown is called when the server answered with a 429: every caller waits for retryAfter if set,
+// otherwise the budgets are exhausted in order to wait for their refill.
+func (rl *rateLimiter) slowDown(retryAfter time.Duration) {
+	rl.access.Lock()
+	defer rl.access.Unlock()
+	if retryAfter > 0 {
+		if until := time.Now().Add(retryAfter); until.After(rl.blockedUntil) {
+			rl.blockedUntil = until
+		}
 		return
 	}
-	wait := jikkanRateLimit - dur
-	c.log.Debugf("[MAL] [RateLimiter] last request was %v ago: waiting %v", dur, wait)
-	t := time.NewTimer(wait)
-	defer t.Stop()
-	select {
-	case <-c.ctx.Done():
-		c.log.Debugf("[MAL] [RateLimiter] context is not valid anymore: %v", c.ctx.Err())
-	case <-t.C:
-		// c.log.Debug("[MAL] [RateLimiter] wait is over")
-		c.lastRequest = time.Now()
+	for _, b := range rl.buckets {
+		b.tokens = 0
+	}
+}
+
+// limitedTransport applies the rate limiter to every request
+type limitedTransport struct {
+	next    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (lt *limitedTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if err = lt.limiter.wait(req.Context()); err != nil {
+		return nil, fmt.Errorf("rate limiter: %w", err)
+	}
+	if resp, err = lt.next.RoundTrip(req); err != nil {
+		return
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+		lt.limiter.log.Warningf("[MAL] [RateLimiter] %s answered with %s: slowing down (retry after: %v)",
+			req.URL.Host, resp.Status, retryAfter)
+		lt.limiter.slowDown(retryAfter)
+	}
+	return
+}
+
+// newLimitedClient returns an HTTP client whose requests go thru limiter.
+// Unsuccessful responses are returned as errors.
+func newLimitedClient(limiter *rateLimiter) *http.Client {
+	return &http.Client{
+		Timeout: httpTimeout,
+		Transport: &checkedTransport{
+			next: &limitedTransport{
+				next:    http.DefaultTransport,
+				limiter: limiter,
+			},
+		},
+	}
+}
+
+// parseRetryAfter supports both the delay in seconds and the HTTP date forms of the Retry-After header
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
 	}
+	return 0
 }
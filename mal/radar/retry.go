@@ -0,0 +1,141 @@
+package radar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	retryMaxTries  = 5
+	retryBaseDelay = 2 * time.Second
+	retryMaxDelay  = 2 * time.Minute
+)
+
+var (
+	// ErrNotFound is matched by the errors returned when the requested resource does not exist (anymore)
+	ErrNotFound = errors.New("not found")
+)
+
+// errorClass drives the retry decision
+type errorClass string
+
+const (
+	// errorTransient covers network errors, 429 and 5xx: retried with an exponential backoff
+	errorTransient errorClass = "transient"
+	// errorNotFound is a 404: the resource does not exist (anymore), not retried
+	errorNotFound errorClass = "not found"
+	// errorMalformed is a truncated or invalid payload: retried as the server may have returned an error page
+	errorMalformed errorClass = "malformed payload"
+	// errorPermanent covers the others 4xx and the payloads not matching the expected schema: not retried
+	errorPermanent errorClass = "permanent"
+	// errorAborted is returned when the context is done
+	errorAborted errorClass = "aborted"
+)
+
+// httpStatusError is returned for unsuccessful HTTP responses
+type httpStatusError struct {
+	code   int
+	status string
+}
+
+func (hse *httpStatusError) Error() string {
+	return "unexpected HTTP status: " + hse.status
+}
+
+func (hse *httpStatusError) Is(target error) bool {
+	return target == ErrNotFound && hse.code == http.StatusNotFound
+}
+
+// checkedTransport turns unsuccessful HTTP responses into errors: callers would try to decode the error page otherwise.
+type checkedTransport struct {
+	next http.RoundTripper
+}
+
+func (ct *checkedTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if resp, err = ct.next.RoundTrip(req); err != nil {
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, &httpStatusError{
+			code:   resp.StatusCode,
+			status: resp.Status,
+		}
+	}
+	return
+}
+
+func classifyError(err error) errorClass {
+	var (
+		statusErr *httpStatusError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	// sources without a 404 (AniList GraphQL for example) return ErrNotFound directly
+	case errors.Is(err, ErrNotFound):
+		return errorNotFound
+	case errors.As(err, &statusErr):
+		switch {
+		case statusErr.code == http.StatusTooManyRequests, statusErr.code >= 500:
+			return errorTransient
+		default:
+			return errorPermanent
+		}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return errorMalformed
+	case errors.As(err, &typeErr):
+		return errorPermanent
+	default:
+		return errorTransient
+	}
+}
+
+// retry calls fn until it succeeds, fails with an error not worth retrying or retryMaxTries is reached.
+// Waits between tries grow exponentially with jitter. operation is used for the logs and the metrics.
+func (c *Controller) retry(operation, description string, fn func() error) (err error) {
+	for try := 1; ; try++ {
+		if err = fn(); err == nil {
+			if try > 1 {
+				c.log.Infof("[MAL] [Retry] %s: %s succeeded at try %d/%d", operation, description, try, retryMaxTries)
+			}
+			return
+		}
+		class := classifyError(err)
+		if c.ctx.Err() != nil {
+			class = errorAborted
+		}
+		switch class {
+		case errorNotFound, errorPermanent, errorAborted:
+			return fmt.Errorf("%s (%s error, not retried): %w", description, class, err)
+		}
+		if try == retryMaxTries {
+			return fmt.Errorf("%s (%s error, try %d/%d): %w", description, class, try, retryMaxTries, err)
+		}
+		delay := backoff(try)
+		c.log.Warningf("[MAL] [Retry] %s: %s failed (%s error, try %d/%d): %v: retrying in %v",
+			operation, description, class, try, retryMaxTries, err, delay)
+		c.metrics.retries.WithLabelValues(operation).Inc()
+		timer := time.NewTimer(delay)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s (retry aborted: %v): %w", description, c.ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before the next try: half of it is fixed, the other half is random
+func backoff(try int) time.Duration {
+	delay := retryBaseDelay << (try - 1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,140 @@
+package radar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	scheduleFile = "schedule.json"
+	// defaultSchedule keeps the historical behavior: a batch every 24 hours
+	defaultSchedule = "@every 24h"
+)
+
+// ScheduleConfig defines when batches are executed
+type ScheduleConfig struct {
+	// Cron is a standard 5 fields cron expression ("0 6 * * *") or a descriptor ("@daily", "@every 12h")
+	Cron string `json:"cron"`
+	// Timezone is the IANA name of the cron expression timezone, local time if empty
+	Timezone string `json:"timezone"`
+}
+
+// scheduleState is the persisted scheduling information
+type scheduleState struct {
+	NextBatch   time.Time `json:"next_batch"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+}
+
+type schedule struct {
+	spec     string
+	cron     cron.Schedule
+	location *time.Location
+}
+
+func newSchedule(conf ScheduleConfig) (s *schedule, err error) {
+	s = &schedule{
+		spec:     conf.Cron,
+		location: time.Local,
+	}
+	if s.spec == "" {
+		s.spec = defaultSchedule
+	}
+	if conf.Timezone != "" {
+		if s.location, err = time.LoadLocation(conf.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone '%s': %w", conf.Timezone, err)
+		}
+	}
+	if s.cron, err = cron.ParseStandard(s.spec); err != nil {
+		return nil, fmt.Errorf("invalid cron expression '%s': %w", s.spec, err)
+	}
+	return
+}
+
+// next returns the first activation time strictly after t
+func (s *schedule) next(t time.Time) time.Time {
+	return s.cron.Next(t.In(s.location))
+}
+
+func (s *schedule) String() string {
+	return fmt.Sprintf("'%s' (%s)", s.spec, s.location)
+}
+
+// firstBatch returns when the first batch must be executed after a start.
+// Unless requested, a batch is only started right away if the scheduled one has been missed.
+func (c *Controller) firstBatch() (next time.Time) {
+	now := time.Now()
+	c.update.Lock()
+	state, err := c.store.loadSchedule()
+	initial := c.watchList == nil
+	c.update.Unlock()
+	if err != nil {
+		c.log.Errorf("[MAL] [Watcher] can't load the persisted schedule: %v", err)
+	} else {
+		c.activity.Lock()
+		c.lastSuccess = state.LastSuccess
+		c.activity.Unlock()
+	}
+	switch {
+	case c.runNow:
+		c.log.Info("[MAL] [Watcher] immediate batch requested: starting a batch now")
+		return now
+	case initial:
+		c.log.Info("[MAL] [Watcher] the watch list must be built: starting a batch now")
+		return now
+	case err != nil:
+		c.log.Info("[MAL] [Watcher] schedule unknown: starting a batch now")
+		return now
+	case !state.LastSuccess.IsZero():
+		// wait for the first scheduled time since the last successful batch
+		next = c.schedule.next(state.LastSuccess)
+		if !state.NextBatch.IsZero() && state.NextBatch.Before(next) {
+			next = state.NextBatch
+		}
+	case !state.NextBatch.IsZero():
+		next = state.NextBatch
+	default:
+		c.log.Info("[MAL] [Watcher] no batch scheduled previously: starting a batch now")
+		return now
+	}
+	if !next.After(now) {
+		c.log.Infof("[MAL] [Watcher] the batch scheduled at %v has been missed: starting it now",
+			next.Format(time.RFC1123))
+		return now
+	}
+	// the schedule may have been changed since
+	if scheduled := c.schedule.next(now); scheduled.Before(next) {
+		next = scheduled
+	}
+	if !state.LastSuccess.IsZero() {
+		c.log.Infof("[MAL] [Watcher] last successful batch on %v: next batch scheduled at %v",
+			state.LastSuccess.Format(time.RFC1123), next.Format(time.RFC1123))
+	} else {
+		c.log.Infof("[MAL] [Watcher] next batch scheduled at %v", next.Format(time.RFC1123))
+	}
+	return
+}
+
+// setNextBatch records and persists the next scheduled batch
+func (c *Controller) setNextBatch(next time.Time) {
+	c.activity.Lock()
+	c.nextBatch = next
+	c.activity.Unlock()
+	c.persistSchedule()
+}
+
+// persistSchedule saves the next scheduled batch and the last successful one
+func (c *Controller) persistSchedule() {
+	c.activity.Lock()
+	state := scheduleState{
+		NextBatch:   c.nextBatch,
+		LastSuccess: c.lastSuccess,
+	}
+	c.activity.Unlock()
+	c.update.Lock()
+	defer c.update.Unlock()
+	if err := c.store.saveSchedule(state); err != nil {
+		c.log.Errorf("[MAL] [Store] can't persist the batches schedule: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package radar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hekmon/hllogger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// SourceJikan is the unofficial Jikan API v4
+	SourceJikan = "jikan"
+	// SourceMAL is the official MyAnimeList API v2, it needs a client ID
+	SourceMAL = "mal"
+	// SourceAniList is the AniList GraphQL API
+	SourceAniList = "anilist"
+	// failoverCooldown is how long the fallback source is used directly once the primary one failed
+	failoverCooldown = 10 * time.Minute
+)
+
+// SourceConfig defines where the animes details are fetched from
+type SourceConfig struct {
+	// Primary is the source used by default: "jikan" (default), "mal" or "anilist"
+	Primary string `json:"primary"`
+	// Fallback is the optional source used when the primary one fails
+	Fallback string `json:"fallback"`
+	// MALClientID is the client ID of a MyAnimeList API application, mandatory to use the "mal" source
+	MALClientID string `json:"mal_client_id"`
+	// AniListScores adds the AniList score to the details of each anime when the source is not AniList
+	AniListScores bool `json:"anilist_scores"`
+}
+
+func newSource(conf SourceConfig, limiter *rateLimiter, m *metrics, logger *hllogger.HlLogger) (source AnimeSource, err error) {
+	if conf.Primary == "" {
+		conf.Primary = SourceJikan
+	}
+	if conf.Primary == conf.Fallback {
+		return nil, fmt.Errorf("the fallback source can't be the primary one ('%s')", conf.Primary)
+	}
+	if source, err = newNamedSource(conf.Primary, conf, limiter, m); err != nil {
+		return nil, fmt.Errorf("primary source: %w", err)
+	}
+	if conf.Fallback != "" {
+		var fallback AnimeSource
+		if fallback, err = newNamedSource(conf.Fallback, conf, limiter, m); err != nil {
+			return nil, fmt.Errorf("fallback source: %w", err)
+		}
+		source = &failoverSource{
+			primary:  source,
+			fallback: fallback,
+			log:      logger,
+		}
+	}
+	if conf.AniListScores && conf.Primary != SourceAniList {
+		source = &scoredSource{
+			AnimeSource: source,
+			anilist:     newAniListSource(newSourceClient(limiter, m.anilistRequests, "")),
+			log:         logger,
+		}
+	}
+	return
+}
+
+func newNamedSource(name string, conf SourceConfig, limiter *rateLimiter, m *metrics) (AnimeSource, error) {
+	switch name {
+	case SourceJikan:
+		return newJikanSource(newSourceClient(limiter, m.jikanRequests, jikanAPIVersion)), nil
+	case SourceMAL:
+		if conf.MALClientID == "" {
+			return nil, errors.New("a MyAnimeList client ID is needed to use the MyAnimeList API")
+		}
+		return newMALSource(newSourceClient(limiter, m.malRequests, malAPIVersion), conf.MALClientID), nil
+	case SourceAniList:
+		return newAniListSource(newSourceClient(limiter, m.anilistRequests, "")), nil
+	default:
+		return nil, fmt.Errorf("unknown source '%s' (valid values are '%s', '%s' and '%s')", name, SourceJikan, SourceMAL, SourceAniList)
+	}
+}
+
+// newSourceClient returns an HTTP client whose requests go thru limiter and are counted within requests.
+// Unsuccessful responses are returned as errors.
+func newSourceClient(limiter *rateLimiter, requests *prometheus.CounterVec, apiPrefix string) *http.Client {
+	return &http.Client{
+		Timeout: httpTimeout,
+		Transport: &checkedTransport{
+			next: &instrumentedTransport{
+				next:      &limitedTransport{next: http.DefaultTransport, limiter: limiter},
+				requests:  requests,
+				apiPrefix: apiPrefix,
+			},
+		},
+	}
+}
+
+// failoverSource uses the fallback source when the primary one fails. Once it failed, the primary
+// source is left aside for failoverCooldown to avoid waiting for a degraded API at each request.
+type failoverSource struct {
+	primary   AnimeSource
+	fallback  AnimeSource
+	access    sync.Mutex
+	downUntil time.Time
+	log       *hllogger.HlLogger
+}
+
+func (fs *failoverSource) Name() string {
+	return fmt.Sprintf("%s (fallback: %s)", fs.primary.Name(), fs.fallback.Name())
+}
+
+func (fs *failoverSource) Season(ctx context.Context, year int, season string) (animes []*Anime, err error) {
+	err = fs.call(ctx, fmt.Sprintf("%s %d season", season, year), func(source AnimeSource) (err error) {
+		animes, err = source.Season(ctx, year, season)
+		return
+	})
+	return
+}
+
+func (fs *failoverSource) Anime(ctx context.Context, malID int) (anime *Anime, err error) {
+	err = fs.call(ctx, fmt.Sprintf("anime %d details", malID), func(source AnimeSource) (err error) {
+		anime, err = source.Anime(ctx, malID)
+		return
+	})
+	return
+}
+
+func (fs *failoverSource) call(ctx context.Context, description string, fn func(source AnimeSource) error) (err error) {
+	fs.access.Lock()
+	degraded := time.Now().Before(fs.downUntil)
+	fs.access.Unlock()
+	if !degraded {
+		// a missing anime or an interruption is not the primary source fault
+		if err = fn(fs.primary); err == nil || errors.Is(err, ErrNotFound) || ctx.Err() != nil {
+			return
+		}
+		fs.access.Lock()
+		fs.downUntil = time.Now().Add(failoverCooldown)
+		fs.access.Unlock()
+		fs.log.Warningf("[MAL] [Source] %s: %s failed: %v: using %s for the next %v",
+			description, fs.primary.Name(), err, fs.fallback.Name(), failoverCooldown)
+	}
+	if errFallback := fn(fs.fallback); errFallback != nil {
+		if err != nil {
+			return fmt.Errorf("%s: %v, %s: %w", fs.primary.Name(), err, fs.fallback.Name(), errFallback)
+		}
+		return fmt.Errorf("%s: %w", fs.fallback.Name(), errFallback)
+	}
+	return nil
+}
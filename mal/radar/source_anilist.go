@@ -0,0 +1,350 @@
+package radar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hekmon/hllogger"
+)
+
+const (
+	anilistEndpoint = "https://graphql.anilist.co"
+	anilistPageSize = 50
+	// anilistMediaFields are the details requested for each anime
+	anilistMediaFields = `
+		id idMal format status episodes duration source(version: 3) genres isAdult
+		title { romaji english native } synonyms description(asHtml: false)
+		tags { name category } averageScore popularity favourites
+		startDate { year month day } endDate { year month day } season seasonYear
+		coverImage { extraLarge large } trailer { id site } studios(isMain: true) { nodes { name } }`
+	anilistSeasonQuery = `query ($page: Int, $perPage: Int, $season: MediaSeason, $seasonYear: Int) {
+	Page(page: $page, perPage: $perPage) {
+		pageInfo { hasNextPage }
+		media(season: $season, seasonYear: $seasonYear, type: ANIME, sort: ID) {` + anilistMediaFields + `
+		}
+	}
+}`
+	anilistAnimeQuery = `query ($idMal: Int) {
+	Media(idMal: $idMal, type: ANIME) {` + anilistMediaFields + `
+	}
+}`
+	anilistScoreQuery = `query ($idMal: Int) {
+	Media(idMal: $idMal, type: ANIME) { averageScore }
+}`
+)
+
+var (
+	// the AniList enums are converted to the labels used by Jikan (and the filters)
+	anilistFormats = map[string]string{
+		"tv":       "TV",
+		"tv_short": "TV",
+		"movie":    "Movie",
+		"special":  "Special",
+		"ova":      "OVA",
+		"ona":      "ONA",
+		"music":    "Music",
+	}
+	anilistStatuses = map[string]string{
+		"finished": animeStatusFinished,
+		// a cancelled anime will not air anymore: consider it as finished to stop tracking it
+		"cancelled":        animeStatusFinished,
+		"releasing":        animeStatusOnGoing,
+		"hiatus":           animeStatusOnGoing,
+		"not_yet_released": animeStatusNotAired,
+	}
+	anilistSources = map[string]string{
+		"light_novel":        "Light novel",
+		"visual_novel":       "Visual novel",
+		"video_game":         "Game",
+		"web_novel":          "Web novel",
+		"picture_book":       "Picture book",
+		"multimedia_project": "Mixed media",
+	}
+)
+
+// anilistSource fetches the animes from the AniList GraphQL API. Animes without a MyAnimeList ID can't be tracked
+// and are left out. AniList does not provide the MyAnimeList statistics: Score is the AniList average score
+// brought back to the MyAnimeList scale and Members is the AniList popularity (the number of users listing the anime).
+// The filters skip the MyAnimeList statistics criteria for the animes it provides.
+type anilistSource struct {
+	client   *http.Client
+	endpoint string
+}
+
+func newAniListSource(client *http.Client) *anilistSource {
+	return &anilistSource{
+		client:   client,
+		endpoint: anilistEndpoint,
+	}
+}
+
+func (as *anilistSource) Name() string {
+	return "AniList"
+}
+
+func (as *anilistSource) Season(ctx context.Context, year int, season string) (animes []*Anime, err error) {
+	seen := make(map[int]struct{})
+	for page := 1; ; page++ {
+		var response struct {
+			Page struct {
+				PageInfo struct {
+					HasNextPage bool `json:"hasNextPage"`
+				} `json:"pageInfo"`
+				Media []anilistMedia `json:"media"`
+			} `json:"Page"`
+		}
+		variables := map[string]interface{}{
+			"page":       page,
+			"perPage":    anilistPageSize,
+			"season":     strings.ToUpper(season),
+			"seasonYear": year,
+		}
+		if err = as.query(ctx, "seasons", anilistSeasonQuery, variables, &response); err != nil {
+			return nil, fmt.Errorf("page %d: %w", page, err)
+		}
+		for _, media := range response.Page.Media {
+			if media.IDMal == 0 {
+				continue
+			}
+			if _, found := seen[media.IDMal]; found {
+				continue
+			}
+			seen[media.IDMal] = struct{}{}
+			animes = append(animes, media.convert())
+		}
+		if !response.Page.PageInfo.HasNextPage {
+			return
+		}
+	}
+}
+
+func (as *anilistSource) Anime(ctx context.Context, malID int) (anime *Anime, err error) {
+	var response struct {
+		Media *anilistMedia `json:"Media"`
+	}
+	if err = as.query(ctx, "anime", anilistAnimeQuery, map[string]interface{}{"idMal": malID}, &response); err != nil {
+		return
+	}
+	if response.Media == nil {
+		return nil, fmt.Errorf("anime %d: %w", malID, ErrNotFound)
+	}
+	return response.Media.convert(), nil
+}
+
+// score returns the AniList average score (out of 100) of an anime, 0 if it has none
+func (as *anilistSource) score(ctx context.Context, malID int) (score float64, err error) {
+	var response struct {
+		Media *struct {
+			AverageScore int `json:"averageScore"`
+		} `json:"Media"`
+	}
+	if err = as.query(ctx, "score", anilistScoreQuery, map[string]interface{}{"idMal": malID}, &response); err != nil {
+		return
+	}
+	if response.Media == nil {
+		return 0, fmt.Errorf("anime %d: %w", malID, ErrNotFound)
+	}
+	return float64(response.Media.AverageScore), nil
+}
+
+// query sends a GraphQL query and decodes its data within payload. Unsuccessful HTTP responses (404 for a missing
+// media included) are turned into errors by the client transport. operation is used as the metrics endpoint label.
+func (as *anilistSource) query(ctx context.Context, operation, query string, variables map[string]interface{}, payload interface{}) (err error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(withEndpoint(ctx, operation), http.MethodPost, as.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := as.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("can't decode %s payload: %w", operation, err)
+	}
+	if len(response.Errors) > 0 {
+		messages := make([]string, len(response.Errors))
+		for index, graphqlErr := range response.Errors {
+			messages[index] = graphqlErr.Message
+		}
+		return fmt.Errorf("%s query failed: %s", operation, strings.Join(messages, ", "))
+	}
+	if err = json.Unmarshal(response.Data, payload); err != nil {
+		return fmt.Errorf("can't decode %s data: %w", operation, err)
+	}
+	return
+}
+
+/*
+	AniList payloads
+*/
+
+type anilistMedia struct {
+	ID       int      `json:"id"`
+	IDMal    int      `json:"idMal"`
+	Format   string   `json:"format"`
+	Status   string   `json:"status"`
+	Episodes int      `json:"episodes"`
+	Duration int      `json:"duration"` // minutes per episode
+	Source   string   `json:"source"`
+	Genres   []string `json:"genres"`
+	IsAdult  bool     `json:"isAdult"`
+	Title    struct {
+		Romaji  string `json:"romaji"`
+		English string `json:"english"`
+		Native  string `json:"native"`
+	} `json:"title"`
+	Synonyms    []string `json:"synonyms"`
+	Description string   `json:"description"`
+	Tags        []struct {
+		Name     string `json:"name"`
+		Category string `json:"category"`
+	} `json:"tags"`
+	AverageScore int         `json:"averageScore"`
+	Popularity   int         `json:"popularity"`
+	Favourites   int         `json:"favourites"`
+	StartDate    anilistDate `json:"startDate"`
+	EndDate      anilistDate `json:"endDate"`
+	Season       string      `json:"season"`
+	SeasonYear   int         `json:"seasonYear"`
+	CoverImage   struct {
+		ExtraLarge string `json:"extraLarge"`
+		Large      string `json:"large"`
+	} `json:"coverImage"`
+	Trailer *struct {
+		ID   string `json:"id"`
+		Site string `json:"site"`
+	} `json:"trailer"`
+	Studios struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"studios"`
+}
+
+// anilistDate is a fuzzy date: any of its elements can be missing
+type anilistDate struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day"`
+}
+
+func (ad anilistDate) time() time.Time {
+	if ad.Year == 0 {
+		return time.Time{}
+	}
+	month, day := time.Month(ad.Month), ad.Day
+	if month == 0 {
+		month = time.January
+	}
+	if day == 0 {
+		day = 1
+	}
+	return time.Date(ad.Year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func (am anilistMedia) convert() (anime *Anime) {
+	anime = &Anime{
+		MalID:         am.IDMal,
+		URL:           fmt.Sprintf("https://myanimelist.net/anime/%d", am.IDMal),
+		ImageURL:      am.CoverImage.ExtraLarge,
+		Title:         am.Title.Romaji,
+		TitleEnglish:  am.Title.English,
+		TitleJapanese: am.Title.Native,
+		TitleSynonyms: am.Synonyms,
+		Type:          malLabel(anilistFormats, strings.ToLower(am.Format)),
+		Source:        malLabel(anilistSources, strings.ToLower(am.Source)),
+		Episodes:      am.Episodes,
+		Status:        malLabel(anilistStatuses, strings.ToLower(am.Status)),
+		Aired: Aired{
+			From: am.StartDate.time(),
+			To:   am.EndDate.time(),
+		},
+		Duration:     formatEpisodeDuration(am.Duration*60, am.Episodes),
+		StatsSource:  statsAniList,
+		Score:        float64(am.AverageScore) / 10,
+		AniListScore: float64(am.AverageScore),
+		Members:      am.Popularity,
+		Favorites:    am.Favourites,
+		Synopsis:     am.Description,
+		Genres:       am.Genres,
+		Studios:      make([]string, len(am.Studios.Nodes)),
+	}
+	if anime.ImageURL == "" {
+		anime.ImageURL = am.CoverImage.Large
+	}
+	if am.IsAdult {
+		anime.Rating = malRatings["rx"]
+	}
+	if am.Season != "" && am.SeasonYear != 0 {
+		anime.Premiered = fmt.Sprintf("%s%s %d", am.Season[:1], strings.ToLower(am.Season[1:]), am.SeasonYear)
+	}
+	if am.Trailer != nil && am.Trailer.Site == "youtube" {
+		anime.TrailerURL = "https://www.youtube.com/watch?v=" + am.Trailer.ID
+	}
+	for _, genre := range am.Genres {
+		if _, found := malThemes[genre]; found {
+			anime.Themes = append(anime.Themes, genre)
+		}
+	}
+	// demographics are tags on AniList, keep them within the genres as the other sources do
+	for _, tag := range am.Tags {
+		if _, found := malDemographics[tag.Name]; found && tag.Category == "Demographic" {
+			anime.Demographics = append(anime.Demographics, tag.Name)
+			anime.Genres = append(anime.Genres, tag.Name)
+		}
+	}
+	for index, studio := range am.Studios.Nodes {
+		anime.Studios[index] = studio.Name
+	}
+	return
+}
+
+// scoredSource adds the AniList score to the animes details of another source
+type scoredSource struct {
+	AnimeSource
+	anilist *anilistSource
+	log     *hllogger.HlLogger
+}
+
+func (ss *scoredSource) Name() string {
+	return fmt.Sprintf("%s (scores: %s)", ss.AnimeSource.Name(), ss.anilist.Name())
+}
+
+// Anime returns the details of the underlying source: failing to get the AniList score does not fail the request
+func (ss *scoredSource) Anime(ctx context.Context, malID int) (anime *Anime, err error) {
+	if anime, err = ss.AnimeSource.Anime(ctx, malID); err != nil || anime.AniListScore != 0 {
+		return
+	}
+	score, errScore := ss.anilist.score(ctx, malID)
+	switch {
+	case errScore == nil:
+		anime.AniListScore = score
+	case errors.Is(errScore, ErrNotFound):
+		ss.log.Debugf("[MAL] [Source] '%s' (MalID %d) is not listed by %s: no second score", getTitle(anime), malID, ss.anilist.Name())
+	default:
+		ss.log.Warningf("[MAL] [Source] can't get the %s score of '%s' (MalID %d): %v", ss.anilist.Name(), getTitle(anime), malID, errScore)
+	}
+	return
+}
@@ -0,0 +1,172 @@
+package radar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	anilistFixtureFMA = `{
+		"id": 5114,
+		"idMal": 5114,
+		"format": "TV",
+		"status": "FINISHED",
+		"episodes": 64,
+		"duration": 24,
+		"source": "MANGA",
+		"genres": ["Action", "Adventure", "Drama"],
+		"isAdult": false,
+		"title": {"romaji": "Hagane no Renkinjutsushi: FULLMETAL ALCHEMIST", "english": "Fullmetal Alchemist: Brotherhood", "native": "鋼の錬金術師 FULLMETAL ALCHEMIST"},
+		"synonyms": ["FMA:B"],
+		"description": "Two brothers search for the Philosopher's Stone.",
+		"tags": [{"name": "Shounen", "category": "Demographic"}, {"name": "Military", "category": "Theme-Other"}],
+		"averageScore": 90,
+		"popularity": 850000,
+		"favourites": 220000,
+		"startDate": {"year": 2009, "month": 4, "day": 5},
+		"endDate": {"year": 2010, "month": 7, "day": null},
+		"season": "SPRING",
+		"seasonYear": 2009,
+		"coverImage": {"extraLarge": "https://s4.anilist.co/file/anilistcdn/media/anime/cover/large/bx5114.jpg", "large": "https://s4.anilist.co/file/anilistcdn/media/anime/cover/medium/bx5114.jpg"},
+		"trailer": {"id": "--IcmZkvL0Q", "site": "youtube"},
+		"studios": {"nodes": [{"name": "bones"}]}
+	}`
+)
+
+// anilistTestRequest is the GraphQL request received by the local server
+type anilistTestRequest struct {
+	Query     string `json:"query"`
+	Variables struct {
+		Page       int    `json:"page"`
+		Season     string `json:"season"`
+		SeasonYear int    `json:"seasonYear"`
+		IDMal      int    `json:"idMal"`
+	} `json:"variables"`
+}
+
+// newAniListTestSource returns an AniList source querying a local server answering with handler
+func newAniListTestSource(t *testing.T, handler func(w http.ResponseWriter, request anilistTestRequest)) *anilistSource {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request anilistTestRequest
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&request) != nil {
+			http.Error(w, `{"errors": [{"message": "invalid request"}]}`, http.StatusBadRequest)
+			return
+		}
+		handler(w, request)
+	}))
+	t.Cleanup(server.Close)
+	source := newAniListSource(&http.Client{Transport: &checkedTransport{next: http.DefaultTransport}})
+	source.endpoint = server.URL
+	return source
+}
+
+func TestAniListSeasonPaging(t *testing.T) {
+	source := newAniListTestSource(t, func(w http.ResponseWriter, request anilistTestRequest) {
+		if request.Variables.Season != "SPRING" || request.Variables.SeasonYear != 2009 {
+			t.Errorf("unexpected season variables: %+v", request.Variables)
+		}
+		switch request.Variables.Page {
+		case 1:
+			fmt.Fprintf(w, `{"data": {"Page": {"pageInfo": {"hasNextPage": true}, "media": [%s, {"id": 2, "idMal": 2}]}}}`, anilistFixtureFMA)
+		case 2:
+			// animes without a MyAnimeList ID can't be tracked, an anime can move between pages while paging
+			fmt.Fprint(w, `{"data": {"Page": {"pageInfo": {"hasNextPage": false}, "media": [{"id": 2, "idMal": 2}, {"id": 99999, "idMal": null}, {"id": 3, "idMal": 3}]}}}`)
+		default:
+			t.Errorf("unexpected page %d", request.Variables.Page)
+			fmt.Fprint(w, `{"data": {"Page": {"pageInfo": {"hasNextPage": false}, "media": []}}}`)
+		}
+	})
+	animes, err := source.Season(context.Background(), 2009, spring)
+	if err != nil {
+		t.Fatalf("can't get season: %v", err)
+	}
+	ids := make([]int, len(animes))
+	for index, anime := range animes {
+		ids[index] = anime.MalID
+	}
+	if !reflect.DeepEqual(ids, []int{5114, 2, 3}) {
+		t.Errorf("unexpected season animes: %v", ids)
+	}
+}
+
+func TestAniListAnime(t *testing.T) {
+	source := newAniListTestSource(t, func(w http.ResponseWriter, request anilistTestRequest) {
+		switch request.Variables.IDMal {
+		case 5114:
+			fmt.Fprintf(w, `{"data": {"Media": %s}}`, anilistFixtureFMA)
+		case 1:
+			fmt.Fprint(w, `{"data": {"Media": {"id": 1, "idMal": 1, "format": "TV_SHORT", "status": "CANCELLED", "source": "VIDEO_GAME", "isAdult": true, "coverImage": {"large": "https://s4.anilist.co/1.jpg"}}}}`)
+		default:
+			// AniList answers a missing media with a 404 and a GraphQL error
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": [{"message": "Not Found.", "status": 404}], "data": {"Media": null}}`)
+		}
+	})
+	anime, err := source.Anime(context.Background(), 5114)
+	if err != nil {
+		t.Fatalf("can't get anime: %v", err)
+	}
+	expected := &Anime{
+		MalID:         5114,
+		URL:           "https://myanimelist.net/anime/5114",
+		ImageURL:      "https://s4.anilist.co/file/anilistcdn/media/anime/cover/large/bx5114.jpg",
+		Title:         "Hagane no Renkinjutsushi: FULLMETAL ALCHEMIST",
+		TitleEnglish:  "Fullmetal Alchemist: Brotherhood",
+		TitleJapanese: "鋼の錬金術師 FULLMETAL ALCHEMIST",
+		TitleSynonyms: []string{"FMA:B"},
+		Type:          "TV",
+		Source:        "Manga",
+		Episodes:      64,
+		Status:        animeStatusFinished,
+		Aired: Aired{
+			From: time.Date(2009, time.April, 5, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2010, time.July, 1, 0, 0, 0, 0, time.UTC),
+		},
+		Duration:     "24 min per ep",
+		StatsSource:  statsAniList,
+		Score:        9,
+		AniListScore: 90,
+		Members:      850000,
+		Favorites:    220000,
+		Synopsis:     "Two brothers search for the Philosopher's Stone.",
+		Premiered:    "Spring 2009",
+		TrailerURL:   "https://www.youtube.com/watch?v=--IcmZkvL0Q",
+		Genres:       []string{"Action", "Adventure", "Drama", "Shounen"},
+		Demographics: []string{"Shounen"},
+		Studios:      []string{"bones"},
+	}
+	if !reflect.DeepEqual(anime, expected) {
+		t.Errorf("unexpected anime:\n%+v\nexpected:\n%+v", anime, expected)
+	}
+	// enums mapping, the large cover is used when there is no extra large one
+	if anime, err = source.Anime(context.Background(), 1); err != nil {
+		t.Fatalf("can't get anime: %v", err)
+	}
+	if anime.Type != "TV" || anime.Status != animeStatusFinished || anime.Source != "Game" ||
+		anime.Rating != "Rx - Hentai" || anime.Duration != "Unknown" || anime.ImageURL != "https://s4.anilist.co/1.jpg" ||
+		!anime.Aired.From.IsZero() {
+		t.Errorf("unexpected labels: %+v", anime)
+	}
+	// missing anime
+	if _, err = source.Anime(context.Background(), 404); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a not found error, got: %v", err)
+	}
+}
+
+func TestAniListQueryErrors(t *testing.T) {
+	source := newAniListTestSource(t, func(w http.ResponseWriter, request anilistTestRequest) {
+		fmt.Fprint(w, `{"errors": [{"message": "Validation error"}, {"message": "Invalid season"}], "data": null}`)
+	})
+	_, err := source.Season(context.Background(), 2009, spring)
+	if err == nil || !strings.Contains(err.Error(), "Validation error, Invalid season") {
+		t.Errorf("expected the GraphQL errors, got: %v", err)
+	}
+}
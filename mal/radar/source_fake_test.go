@@ -0,0 +1,120 @@
+package radar
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// fakeSource is an in memory AnimeSource: seasons and animes are set by the tests.
+// It is safe for concurrent use.
+type fakeSource struct {
+	access  sync.Mutex
+	seasons map[string][]int
+	animes  map[int]*Anime
+	errors  map[int]error
+	// seasonsErr makes every season request fail if set
+	seasonsErr error
+}
+
+// newFakeSource returns an empty fakeSource
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		seasons: make(map[string][]int),
+		animes:  make(map[int]*Anime),
+		errors:  make(map[int]error),
+	}
+}
+
+// Name implements AnimeSource
+func (fs *fakeSource) Name() string {
+	return "fake"
+}
+
+// AddToSeason registers anime within a season and sets its details
+func (fs *fakeSource) AddToSeason(year int, season string, anime *Anime) {
+	fs.access.Lock()
+	defer fs.access.Unlock()
+	key := fakeSeasonKey(year, season)
+	for _, malID := range fs.seasons[key] {
+		if malID == anime.MalID {
+			fs.animes[anime.MalID] = anime
+			return
+		}
+	}
+	fs.seasons[key] = append(fs.seasons[key], anime.MalID)
+	fs.animes[anime.MalID] = anime
+}
+
+// Set replaces the details of an anime, its status for example
+func (fs *fakeSource) Set(anime *Anime) {
+	fs.access.Lock()
+	defer fs.access.Unlock()
+	fs.animes[anime.MalID] = anime
+}
+
+// Remove makes an anime unknown: its details requests will fail with ErrNotFound
+func (fs *fakeSource) Remove(malID int) {
+	fs.access.Lock()
+	defer fs.access.Unlock()
+	delete(fs.animes, malID)
+}
+
+// Fail makes the details requests of an anime fail with err, a nil err restores them
+func (fs *fakeSource) Fail(malID int, err error) {
+	fs.access.Lock()
+	defer fs.access.Unlock()
+	if err == nil {
+		delete(fs.errors, malID)
+	} else {
+		fs.errors[malID] = err
+	}
+}
+
+// FailSeasons makes the season requests fail with err, a nil err restores them
+func (fs *fakeSource) FailSeasons(err error) {
+	fs.access.Lock()
+	defer fs.access.Unlock()
+	fs.seasonsErr = err
+}
+
+// Season implements AnimeSource
+func (fs *fakeSource) Season(ctx context.Context, year int, season string) (animes []*Anime, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	fs.access.Lock()
+	defer fs.access.Unlock()
+	if err = fs.seasonsErr; err != nil {
+		return
+	}
+	for _, malID := range fs.seasons[fakeSeasonKey(year, season)] {
+		if anime, found := fs.animes[malID]; found {
+			copied := *anime
+			animes = append(animes, &copied)
+		}
+	}
+	return
+}
+
+// Anime implements AnimeSource
+func (fs *fakeSource) Anime(ctx context.Context, malID int) (anime *Anime, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	fs.access.Lock()
+	defer fs.access.Unlock()
+	if err = fs.errors[malID]; err != nil {
+		return
+	}
+	details, found := fs.animes[malID]
+	if !found {
+		return nil, fmt.Errorf("anime %d: %w", malID, ErrNotFound)
+	}
+	copied := *details
+	return &copied, nil
+}
+
+func fakeSeasonKey(year int, season string) string {
+	return fmt.Sprintf("%s %d", season, year)
+}
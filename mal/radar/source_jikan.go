@@ -0,0 +1,210 @@
+package radar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	jikanAPIVersion = "/v4"
+	jikanBaseURL    = "https://api.jikan.moe" + jikanAPIVersion
+)
+
+// jikanSource fetches the animes from the Jikan API v4 (unofficial MyAnimeList API)
+type jikanSource struct {
+	client  *http.Client
+	baseURL string
+}
+
+func newJikanSource(client *http.Client) *jikanSource {
+	return &jikanSource{
+		client:  client,
+		baseURL: jikanBaseURL,
+	}
+}
+
+func (js *jikanSource) Name() string {
+	return "Jikan v4"
+}
+
+func (js *jikanSource) Season(ctx context.Context, year int, season string) (animes []*Anime, err error) {
+	seen := make(map[int]struct{})
+	for page := 1; ; page++ {
+		var response jikanSeasonResponse
+		query := url.Values{}
+		query.Set("page", fmt.Sprintf("%d", page))
+		if err = js.get(ctx, fmt.Sprintf("/seasons/%d/%s", year, season), query, &response); err != nil {
+			return nil, fmt.Errorf("page %d: %w", page, err)
+		}
+		for _, anime := range response.Data {
+			// entries may be duplicated across pages when the listing changes while paginating
+			if _, found := seen[anime.MalID]; found {
+				continue
+			}
+			seen[anime.MalID] = struct{}{}
+			animes = append(animes, anime.convert())
+		}
+		if !response.Pagination.HasNextPage {
+			return
+		}
+	}
+}
+
+func (js *jikanSource) Anime(ctx context.Context, malID int) (anime *Anime, err error) {
+	var response jikanAnimeResponse
+	if err = js.get(ctx, fmt.Sprintf("/anime/%d/full", malID), nil, &response); err != nil {
+		return
+	}
+	if response.Data.MalID == 0 {
+		return nil, fmt.Errorf("anime %d: empty payload", malID)
+	}
+	return response.Data.convert(), nil
+}
+
+// get decodes the JSON payload of an endpoint. Unsuccessful HTTP responses are turned into errors by the client transport.
+func (js *jikanSource) get(ctx context.Context, path string, query url.Values, payload interface{}) (err error) {
+	target := js.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return
+	}
+	resp, err := js.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(payload); err != nil {
+		return fmt.Errorf("can't decode %s payload: %w", path, err)
+	}
+	return
+}
+
+/*
+	Jikan v4 payloads
+*/
+
+type jikanSeasonResponse struct {
+	Pagination struct {
+		HasNextPage bool `json:"has_next_page"`
+	} `json:"pagination"`
+	Data []jikanAnime `json:"data"`
+}
+
+type jikanAnimeResponse struct {
+	Data jikanAnime `json:"data"`
+}
+
+type jikanAnime struct {
+	MalID  int    `json:"mal_id"`
+	URL    string `json:"url"`
+	Images struct {
+		JPG struct {
+			ImageURL      string `json:"image_url"`
+			LargeImageURL string `json:"large_image_url"`
+		} `json:"jpg"`
+	} `json:"images"`
+	Trailer struct {
+		URL string `json:"url"`
+	} `json:"trailer"`
+	Title         string   `json:"title"`
+	TitleEnglish  string   `json:"title_english"`
+	TitleJapanese string   `json:"title_japanese"`
+	TitleSynonyms []string `json:"title_synonyms"`
+	Type          string   `json:"type"`
+	Source        string   `json:"source"`
+	Episodes      int      `json:"episodes"`
+	Status        string   `json:"status"`
+	Aired         struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"aired"`
+	Duration       string          `json:"duration"`
+	Rating         string          `json:"rating"`
+	Score          float64         `json:"score"`
+	ScoredBy       int             `json:"scored_by"`
+	Rank           int             `json:"rank"`
+	Popularity     int             `json:"popularity"`
+	Members        int             `json:"members"`
+	Favorites      int             `json:"favorites"`
+	Synopsis       string          `json:"synopsis"`
+	Background     string          `json:"background"`
+	Season         string          `json:"season"`
+	Year           int             `json:"year"`
+	Producers      []jikanResource `json:"producers"`
+	Licensors      []jikanResource `json:"licensors"`
+	Studios        []jikanResource `json:"studios"`
+	Genres         []jikanResource `json:"genres"`
+	ExplicitGenres []jikanResource `json:"explicit_genres"`
+	Themes         []jikanResource `json:"themes"`
+	Demographics   []jikanResource `json:"demographics"`
+}
+
+type jikanResource struct {
+	MalID int    `json:"mal_id"`
+	Name  string `json:"name"`
+}
+
+func (ja jikanAnime) convert() (anime *Anime) {
+	anime = &Anime{
+		MalID:         ja.MalID,
+		URL:           ja.URL,
+		ImageURL:      ja.Images.JPG.LargeImageURL,
+		Title:         ja.Title,
+		TitleEnglish:  ja.TitleEnglish,
+		TitleJapanese: ja.TitleJapanese,
+		TitleSynonyms: ja.TitleSynonyms,
+		Type:          ja.Type,
+		Source:        ja.Source,
+		Episodes:      ja.Episodes,
+		Status:        ja.Status,
+		Aired: Aired{
+			From: ja.Aired.From,
+			To:   ja.Aired.To,
+		},
+		Duration:     ja.Duration,
+		Rating:       ja.Rating,
+		StatsSource:  statsMyAnimeList,
+		Score:        ja.Score,
+		ScoredBy:     ja.ScoredBy,
+		Rank:         ja.Rank,
+		Popularity:   ja.Popularity,
+		Members:      ja.Members,
+		Favorites:    ja.Favorites,
+		Synopsis:     ja.Synopsis,
+		Background:   ja.Background,
+		TrailerURL:   ja.Trailer.URL,
+		Themes:       jikanNames(ja.Themes),
+		Demographics: jikanNames(ja.Demographics),
+		Studios:      jikanNames(ja.Studios),
+		Producers:    jikanNames(ja.Producers),
+		Licensors:    jikanNames(ja.Licensors),
+	}
+	if anime.ImageURL == "" {
+		anime.ImageURL = ja.Images.JPG.ImageURL
+	}
+	if ja.Season != "" && ja.Year != 0 {
+		anime.Premiered = fmt.Sprintf("%s%s %d", strings.ToUpper(ja.Season[:1]), ja.Season[1:], ja.Year)
+	}
+	// v4 splits what v3 used to return as genres: keep them together as before
+	anime.Genres = make([]string, 0, len(ja.Genres)+len(ja.ExplicitGenres)+len(ja.Themes)+len(ja.Demographics))
+	for _, list := range [][]jikanResource{ja.Genres, ja.ExplicitGenres, ja.Themes, ja.Demographics} {
+		anime.Genres = append(anime.Genres, jikanNames(list)...)
+	}
+	return
+}
+
+func jikanNames(resources []jikanResource) (names []string) {
+	names = make([]string, len(resources))
+	for index, resource := range resources {
+		names[index] = resource.Name
+	}
+	return
+}
@@ -0,0 +1,165 @@
+package radar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	jikanFixtureFMA = `{
+		"mal_id": 5114,
+		"url": "https://myanimelist.net/anime/5114/Fullmetal_Alchemist__Brotherhood",
+		"images": {"jpg": {"image_url": "https://cdn.myanimelist.net/images/anime/1208/94745.jpg", "large_image_url": "https://cdn.myanimelist.net/images/anime/1208/94745l.jpg"}},
+		"trailer": {"url": "https://www.youtube.com/watch?v=--IcmZkvL0Q"},
+		"title": "Fullmetal Alchemist: Brotherhood",
+		"title_english": "Fullmetal Alchemist: Brotherhood",
+		"title_japanese": "鋼の錬金術師 FULLMETAL ALCHEMIST",
+		"title_synonyms": ["Hagane no Renkinjutsushi: Fullmetal Alchemist"],
+		"type": "TV",
+		"source": "Manga",
+		"episodes": 64,
+		"status": "Finished Airing",
+		"aired": {"from": "2009-04-05T00:00:00+00:00", "to": "2010-07-04T00:00:00+00:00"},
+		"duration": "24 min per ep",
+		"rating": "R - 17+ (violence & profanity)",
+		"score": 9.1,
+		"scored_by": 2000000,
+		"rank": 1,
+		"popularity": 3,
+		"members": 3200000,
+		"favorites": 220000,
+		"synopsis": "Two brothers search for the Philosopher's Stone.",
+		"background": "Second adaptation of the manga.",
+		"season": "spring",
+		"year": 2009,
+		"producers": [{"mal_id": 17, "name": "Aniplex"}],
+		"licensors": [{"mal_id": 102, "name": "Funimation"}],
+		"studios": [{"mal_id": 4, "name": "Bones"}],
+		"genres": [{"mal_id": 1, "name": "Action"}, {"mal_id": 2, "name": "Adventure"}],
+		"explicit_genres": [],
+		"themes": [{"mal_id": 38, "name": "Military"}],
+		"demographics": [{"mal_id": 27, "name": "Shounen"}]
+	}`
+)
+
+// newJikanTestSource returns a Jikan source querying a local server answering with handler
+func newJikanTestSource(t *testing.T, handler http.HandlerFunc) *jikanSource {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	source := newJikanSource(&http.Client{Transport: &checkedTransport{next: http.DefaultTransport}})
+	source.baseURL = server.URL
+	return source
+}
+
+func TestJikanSeasonPaging(t *testing.T) {
+	source := newJikanTestSource(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/seasons/2009/spring" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			fmt.Fprintf(w, `{"pagination": {"has_next_page": true}, "data": [%s, {"mal_id": 2, "title": "Second"}]}`, jikanFixtureFMA)
+		case "2":
+			// an anime can move between pages while paging
+			fmt.Fprint(w, `{"pagination": {"has_next_page": false}, "data": [{"mal_id": 2, "title": "Second"}, {"mal_id": 3, "title": "Third"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	animes, err := source.Season(context.Background(), 2009, spring)
+	if err != nil {
+		t.Fatalf("can't get season: %v", err)
+	}
+	ids := make([]int, len(animes))
+	for index, anime := range animes {
+		ids[index] = anime.MalID
+	}
+	if !reflect.DeepEqual(ids, []int{5114, 2, 3}) {
+		t.Errorf("unexpected season animes: %v", ids)
+	}
+}
+
+func TestJikanAnime(t *testing.T) {
+	source := newJikanTestSource(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/anime/5114/full":
+			fmt.Fprintf(w, `{"data": %s}`, jikanFixtureFMA)
+		case "/anime/1/full":
+			fmt.Fprint(w, `{"data": {"mal_id": 1, "images": {"jpg": {"image_url": "https://cdn.myanimelist.net/images/anime/1/1.jpg"}}}}`)
+		case "/anime/2/full":
+			fmt.Fprint(w, `{"data": {}}`)
+		default:
+			http.Error(w, `{"status": 404, "type": "BadResponseException", "message": "Resource does not exist"}`, http.StatusNotFound)
+		}
+	})
+	anime, err := source.Anime(context.Background(), 5114)
+	if err != nil {
+		t.Fatalf("can't get anime: %v", err)
+	}
+	expected := &Anime{
+		MalID:         5114,
+		URL:           "https://myanimelist.net/anime/5114/Fullmetal_Alchemist__Brotherhood",
+		ImageURL:      "https://cdn.myanimelist.net/images/anime/1208/94745l.jpg",
+		Title:         "Fullmetal Alchemist: Brotherhood",
+		TitleEnglish:  "Fullmetal Alchemist: Brotherhood",
+		TitleJapanese: "鋼の錬金術師 FULLMETAL ALCHEMIST",
+		TitleSynonyms: []string{"Hagane no Renkinjutsushi: Fullmetal Alchemist"},
+		Type:          "TV",
+		Source:        "Manga",
+		Episodes:      64,
+		Status:        animeStatusFinished,
+		Aired: Aired{
+			From: time.Date(2009, time.April, 5, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2010, time.July, 4, 0, 0, 0, 0, time.UTC),
+		},
+		Duration:     "24 min per ep",
+		Rating:       "R - 17+ (violence & profanity)",
+		StatsSource:  statsMyAnimeList,
+		Score:        9.1,
+		ScoredBy:     2000000,
+		Rank:         1,
+		Popularity:   3,
+		Members:      3200000,
+		Favorites:    220000,
+		Synopsis:     "Two brothers search for the Philosopher's Stone.",
+		Background:   "Second adaptation of the manga.",
+		Premiered:    "Spring 2009",
+		TrailerURL:   "https://www.youtube.com/watch?v=--IcmZkvL0Q",
+		Genres:       []string{"Action", "Adventure", "Military", "Shounen"},
+		Themes:       []string{"Military"},
+		Demographics: []string{"Shounen"},
+		Studios:      []string{"Bones"},
+		Producers:    []string{"Aniplex"},
+		Licensors:    []string{"Funimation"},
+	}
+	if !anime.Aired.From.Equal(expected.Aired.From) || !anime.Aired.To.Equal(expected.Aired.To) {
+		t.Errorf("unexpected aired dates: %+v", anime.Aired)
+	}
+	// the dates are compared above as their location differs
+	anime.Aired = expected.Aired
+	if !reflect.DeepEqual(anime, expected) {
+		t.Errorf("unexpected anime:\n%+v\nexpected:\n%+v", anime, expected)
+	}
+	// the small picture is used when there is no large one
+	if anime, err = source.Anime(context.Background(), 1); err != nil {
+		t.Fatalf("can't get anime: %v", err)
+	}
+	if anime.ImageURL != "https://cdn.myanimelist.net/images/anime/1/1.jpg" || anime.Premiered != "" {
+		t.Errorf("unexpected anime: %+v", anime)
+	}
+	// empty payload
+	if _, err = source.Anime(context.Background(), 2); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected an empty payload error, got: %v", err)
+	}
+	// missing anime
+	if _, err = source.Anime(context.Background(), 404); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a not found error, got: %v", err)
+	}
+}
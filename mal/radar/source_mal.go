@@ -0,0 +1,342 @@
+package radar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	malAPIVersion = "/v2"
+	malBaseURL    = "https://api.myanimelist.net" + malAPIVersion
+	malPageSize   = 500
+	// malAnimeFields are the details requested for each anime, the API only returns id, title and main_picture otherwise
+	malAnimeFields = "id,title,main_picture,alternative_titles,start_date,end_date,synopsis,background,mean,rank," +
+		"popularity,num_list_users,num_scoring_users,media_type,status,genres,num_episodes,start_season,source," +
+		"average_episode_duration,rating,studios"
+)
+
+var (
+	// the official API does not tell apart genres, themes and demographics
+	malDemographics = map[string]struct{}{
+		"Josei":   {},
+		"Kids":    {},
+		"Seinen":  {},
+		"Shoujo":  {},
+		"Shounen": {},
+	}
+	malThemes = map[string]struct{}{
+		"Adult Cast":        {},
+		"Anthropomorphic":   {},
+		"CGDCT":             {},
+		"Childcare":         {},
+		"Combat Sports":     {},
+		"Crossdressing":     {},
+		"Delinquents":       {},
+		"Detective":         {},
+		"Educational":       {},
+		"Gag Humor":         {},
+		"Gore":              {},
+		"Harem":             {},
+		"High Stakes Game":  {},
+		"Historical":        {},
+		"Idols (Female)":    {},
+		"Idols (Male)":      {},
+		"Isekai":            {},
+		"Iyashikei":         {},
+		"Love Polygon":      {},
+		"Love Status Quo":   {},
+		"Magical Sex Shift": {},
+		"Mahou Shoujo":      {},
+		"Martial Arts":      {},
+		"Mecha":             {},
+		"Medical":           {},
+		"Military":          {},
+		"Music":             {},
+		"Mythology":         {},
+		"Organized Crime":   {},
+		"Otaku Culture":     {},
+		"Parody":            {},
+		"Performing Arts":   {},
+		"Pets":              {},
+		"Psychological":     {},
+		"Racing":            {},
+		"Reincarnation":     {},
+		"Reverse Harem":     {},
+		"Romantic Subtext":  {},
+		"Samurai":           {},
+		"School":            {},
+		"Showbiz":           {},
+		"Space":             {},
+		"Strategy Game":     {},
+		"Super Power":       {},
+		"Survival":          {},
+		"Team Sports":       {},
+		"Time Travel":       {},
+		"Urban Fantasy":     {},
+		"Vampire":           {},
+		"Video Game":        {},
+		"Villainess":        {},
+		"Visual Arts":       {},
+		"Workplace":         {},
+	}
+	// the official API returns identifiers, convert them to the labels used by Jikan (and the filters)
+	malMediaTypes = map[string]string{
+		"tv":         "TV",
+		"ova":        "OVA",
+		"movie":      "Movie",
+		"special":    "Special",
+		"ona":        "ONA",
+		"music":      "Music",
+		"tv_special": "TV Special",
+		"cm":         "CM",
+		"pv":         "PV",
+	}
+	malStatuses = map[string]string{
+		"finished_airing":  animeStatusFinished,
+		"currently_airing": animeStatusOnGoing,
+		"not_yet_aired":    animeStatusNotAired,
+	}
+	malRatings = map[string]string{
+		"g":     "G - All Ages",
+		"pg":    "PG - Children",
+		"pg_13": "PG-13 - Teens 13 or older",
+		"r":     "R - 17+ (violence & profanity)",
+		"r+":    "R+ - Mild Nudity",
+		"rx":    "Rx - Hentai",
+	}
+	malSources = map[string]string{
+		"4_koma_manga": "4-koma manga",
+		"web_manga":    "Web manga",
+		"web_novel":    "Web novel",
+		"light_novel":  "Light novel",
+		"visual_novel": "Visual novel",
+		"card_game":    "Card game",
+		"picture_book": "Picture book",
+		"mixed_media":  "Mixed media",
+	}
+)
+
+// malSource fetches the animes from the official MyAnimeList API v2
+type malSource struct {
+	client   *http.Client
+	baseURL  string
+	clientID string
+}
+
+func newMALSource(client *http.Client, clientID string) *malSource {
+	return &malSource{
+		client:   client,
+		baseURL:  malBaseURL,
+		clientID: clientID,
+	}
+}
+
+func (ms *malSource) Name() string {
+	return "MyAnimeList API v2"
+}
+
+func (ms *malSource) Season(ctx context.Context, year int, season string) (animes []*Anime, err error) {
+	query := url.Values{}
+	query.Set("limit", fmt.Sprintf("%d", malPageSize))
+	query.Set("nsfw", "true")
+	target := fmt.Sprintf("%s/anime/season/%d/%s?%s", ms.baseURL, year, season, query.Encode())
+	seen := make(map[int]struct{})
+	for page := 1; target != ""; page++ {
+		var response malSeasonResponse
+		if err = ms.get(ctx, target, &response); err != nil {
+			return nil, fmt.Errorf("page %d: %w", page, err)
+		}
+		for _, entry := range response.Data {
+			if _, found := seen[entry.Node.ID]; found {
+				continue
+			}
+			seen[entry.Node.ID] = struct{}{}
+			animes = append(animes, entry.Node.convert())
+		}
+		target = response.Paging.Next
+	}
+	return
+}
+
+func (ms *malSource) Anime(ctx context.Context, malID int) (anime *Anime, err error) {
+	query := url.Values{}
+	query.Set("fields", malAnimeFields)
+	var response malAnime
+	if err = ms.get(ctx, fmt.Sprintf("%s/anime/%d?%s", ms.baseURL, malID, query.Encode()), &response); err != nil {
+		return
+	}
+	if response.ID == 0 {
+		return nil, fmt.Errorf("anime %d: empty payload", malID)
+	}
+	return response.convert(), nil
+}
+
+// get decodes the JSON payload of target. Unsuccessful HTTP responses are turned into errors by the client transport.
+func (ms *malSource) get(ctx context.Context, target string, payload interface{}) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-MAL-CLIENT-ID", ms.clientID)
+	resp, err := ms.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(payload); err != nil {
+		return fmt.Errorf("can't decode %s payload: %w", req.URL.Path, err)
+	}
+	return
+}
+
+/*
+	MyAnimeList API v2 payloads
+*/
+
+type malSeasonResponse struct {
+	Data []struct {
+		Node malAnime `json:"node"`
+	} `json:"data"`
+	Paging struct {
+		Next string `json:"next"`
+	} `json:"paging"`
+}
+
+type malAnime struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	MainPicture struct {
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"main_picture"`
+	AlternativeTitles struct {
+		Synonyms []string `json:"synonyms"`
+		EN       string   `json:"en"`
+		JA       string   `json:"ja"`
+	} `json:"alternative_titles"`
+	StartDate   string  `json:"start_date"`
+	EndDate     string  `json:"end_date"`
+	Synopsis    string  `json:"synopsis"`
+	Background  string  `json:"background"`
+	Mean        float64 `json:"mean"`
+	Rank        int     `json:"rank"`
+	Popularity  int     `json:"popularity"`
+	ListUsers   int     `json:"num_list_users"`
+	ScoringUser int     `json:"num_scoring_users"`
+	MediaType   string  `json:"media_type"`
+	Status      string  `json:"status"`
+	Genres      []struct {
+		Name string `json:"name"`
+	} `json:"genres"`
+	Episodes    int `json:"num_episodes"`
+	StartSeason struct {
+		Year   int    `json:"year"`
+		Season string `json:"season"`
+	} `json:"start_season"`
+	Source          string `json:"source"`
+	EpisodeDuration int    `json:"average_episode_duration"`
+	Rating          string `json:"rating"`
+	Studios         []struct {
+		Name string `json:"name"`
+	} `json:"studios"`
+}
+
+func (ma malAnime) convert() (anime *Anime) {
+	anime = &Anime{
+		MalID:         ma.ID,
+		URL:           fmt.Sprintf("https://myanimelist.net/anime/%d", ma.ID),
+		ImageURL:      ma.MainPicture.Large,
+		Title:         ma.Title,
+		TitleEnglish:  ma.AlternativeTitles.EN,
+		TitleJapanese: ma.AlternativeTitles.JA,
+		TitleSynonyms: ma.AlternativeTitles.Synonyms,
+		Type:          malLabel(malMediaTypes, ma.MediaType),
+		Source:        malLabel(malSources, ma.Source),
+		Episodes:      ma.Episodes,
+		Status:        malLabel(malStatuses, ma.Status),
+		Aired: Aired{
+			From: parseMALDate(ma.StartDate),
+			To:   parseMALDate(ma.EndDate),
+		},
+		Duration:    formatEpisodeDuration(ma.EpisodeDuration, ma.Episodes),
+		Rating:      malLabel(malRatings, ma.Rating),
+		StatsSource: statsMyAnimeList,
+		Score:       ma.Mean,
+		ScoredBy:    ma.ScoringUser,
+		Rank:        ma.Rank,
+		Popularity:  ma.Popularity,
+		Members:     ma.ListUsers,
+		Synopsis:    ma.Synopsis,
+		Background:  ma.Background,
+		Genres:      make([]string, len(ma.Genres)),
+		Studios:     make([]string, len(ma.Studios)),
+	}
+	if anime.ImageURL == "" {
+		anime.ImageURL = ma.MainPicture.Medium
+	}
+	if ma.StartSeason.Season != "" && ma.StartSeason.Year != 0 {
+		anime.Premiered = fmt.Sprintf("%s%s %d", strings.ToUpper(ma.StartSeason.Season[:1]),
+			ma.StartSeason.Season[1:], ma.StartSeason.Year)
+	}
+	for index, genre := range ma.Genres {
+		anime.Genres[index] = genre.Name
+		if _, found := malThemes[genre.Name]; found {
+			anime.Themes = append(anime.Themes, genre.Name)
+		} else if _, found = malDemographics[genre.Name]; found {
+			anime.Demographics = append(anime.Demographics, genre.Name)
+		}
+	}
+	for index, studio := range ma.Studios {
+		anime.Studios[index] = studio.Name
+	}
+	return
+}
+
+// malLabel converts an API identifier to its label, unknown ones are made readable ("light_novel" -> "Light novel")
+func malLabel(labels map[string]string, value string) string {
+	if label, found := labels[value]; found {
+		return label
+	}
+	if value == "" {
+		return ""
+	}
+	value = strings.ReplaceAll(value, "_", " ")
+	return strings.ToUpper(value[:1]) + value[1:]
+}
+
+// parseMALDate supports the partial dates returned by the API ("2021", "2021-04", "2021-04-02")
+func parseMALDate(date string) time.Time {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if parsed, err := time.Parse(layout, date); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
+
+// formatEpisodeDuration formats an episode duration the way Jikan does ("24 min per ep", "1 hr 45 min")
+func formatEpisodeDuration(seconds, episodes int) (duration string) {
+	if seconds <= 0 {
+		return "Unknown"
+	}
+	hours, minutes := seconds/3600, (seconds%3600)/60
+	switch {
+	case hours > 0 && minutes > 0:
+		duration = fmt.Sprintf("%d hr %d min", hours, minutes)
+	case hours > 0:
+		duration = fmt.Sprintf("%d hr", hours)
+	case minutes > 0:
+		duration = fmt.Sprintf("%d min", minutes)
+	default:
+		duration = fmt.Sprintf("%d sec", seconds)
+	}
+	if episodes != 1 {
+		duration += " per ep"
+	}
+	return
+}
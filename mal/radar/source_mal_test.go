@@ -0,0 +1,190 @@
+package radar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	malFixtureFMA = `{
+		"id": 5114,
+		"title": "Fullmetal Alchemist: Brotherhood",
+		"main_picture": {"medium": "https://cdn.myanimelist.net/images/anime/1208/94745.jpg", "large": "https://cdn.myanimelist.net/images/anime/1208/94745l.jpg"},
+		"alternative_titles": {"synonyms": ["Hagane no Renkinjutsushi: Fullmetal Alchemist"], "en": "Fullmetal Alchemist: Brotherhood", "ja": "鋼の錬金術師 FULLMETAL ALCHEMIST"},
+		"start_date": "2009-04-05",
+		"end_date": "2010-07",
+		"mean": 9.1,
+		"rank": 1,
+		"popularity": 3,
+		"num_list_users": 3200000,
+		"num_scoring_users": 2000000,
+		"media_type": "tv",
+		"status": "finished_airing",
+		"genres": [{"name": "Action"}, {"name": "Military"}, {"name": "Shounen"}],
+		"num_episodes": 64,
+		"start_season": {"year": 2009, "season": "spring"},
+		"source": "manga",
+		"average_episode_duration": 1440,
+		"rating": "r",
+		"studios": [{"name": "Bones"}]
+	}`
+	malFixtureUnknownLabels = `{
+		"id": 1,
+		"title": "Unknown labels",
+		"main_picture": {"medium": "https://cdn.myanimelist.net/images/anime/1/1.jpg"},
+		"start_date": "2023",
+		"media_type": "tv_special",
+		"status": "on_hiatus",
+		"source": "4_koma_manga",
+		"rating": "pg_13"
+	}`
+)
+
+// newMALTestSource returns a MAL source querying a local server answering with handler
+func newMALTestSource(t *testing.T, handler http.HandlerFunc) *malSource {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	source := newMALSource(&http.Client{Transport: &checkedTransport{next: http.DefaultTransport}}, "client-id")
+	source.baseURL = server.URL
+	return source
+}
+
+func TestMALSeasonPaging(t *testing.T) {
+	var serverURL string
+	source := newMALTestSource(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-MAL-CLIENT-ID") != "client-id" {
+			http.Error(w, `{"error": "invalid client id"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/anime/season/2009/spring" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("offset") {
+		case "":
+			fmt.Fprintf(w, `{"data": [{"node": %s}, {"node": {"id": 2, "title": "Second"}}],
+				"paging": {"next": "%s/anime/season/2009/spring?offset=2"}}`, malFixtureFMA, serverURL)
+		case "2":
+			// an anime can move between pages while paging
+			fmt.Fprint(w, `{"data": [{"node": {"id": 2, "title": "Second"}}, {"node": {"id": 3, "title": "Third"}}], "paging": {}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	serverURL = source.baseURL
+	animes, err := source.Season(context.Background(), 2009, spring)
+	if err != nil {
+		t.Fatalf("can't get season: %v", err)
+	}
+	ids := make([]int, len(animes))
+	for index, anime := range animes {
+		ids[index] = anime.MalID
+	}
+	if !reflect.DeepEqual(ids, []int{5114, 2, 3}) {
+		t.Errorf("unexpected season animes: %v", ids)
+	}
+}
+
+func TestMALAnime(t *testing.T) {
+	source := newMALTestSource(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/anime/5114":
+			if r.URL.Query().Get("fields") != malAnimeFields {
+				t.Errorf("unexpected fields: %s", r.URL.Query().Get("fields"))
+			}
+			fmt.Fprint(w, malFixtureFMA)
+		case "/anime/1":
+			fmt.Fprint(w, malFixtureUnknownLabels)
+		default:
+			http.Error(w, `{"message": "", "error": "not_found"}`, http.StatusNotFound)
+		}
+	})
+	anime, err := source.Anime(context.Background(), 5114)
+	if err != nil {
+		t.Fatalf("can't get anime: %v", err)
+	}
+	expected := &Anime{
+		MalID:         5114,
+		URL:           "https://myanimelist.net/anime/5114",
+		ImageURL:      "https://cdn.myanimelist.net/images/anime/1208/94745l.jpg",
+		Title:         "Fullmetal Alchemist: Brotherhood",
+		TitleEnglish:  "Fullmetal Alchemist: Brotherhood",
+		TitleJapanese: "鋼の錬金術師 FULLMETAL ALCHEMIST",
+		TitleSynonyms: []string{"Hagane no Renkinjutsushi: Fullmetal Alchemist"},
+		Type:          "TV",
+		Source:        "Manga",
+		Episodes:      64,
+		Status:        animeStatusFinished,
+		Aired: Aired{
+			From: time.Date(2009, time.April, 5, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2010, time.July, 1, 0, 0, 0, 0, time.UTC),
+		},
+		Duration:     "24 min per ep",
+		Rating:       "R - 17+ (violence & profanity)",
+		StatsSource:  statsMyAnimeList,
+		Score:        9.1,
+		ScoredBy:     2000000,
+		Rank:         1,
+		Popularity:   3,
+		Members:      3200000,
+		Premiered:    "Spring 2009",
+		Genres:       []string{"Action", "Military", "Shounen"},
+		Themes:       []string{"Military"},
+		Demographics: []string{"Shounen"},
+		Studios:      []string{"Bones"},
+	}
+	if !reflect.DeepEqual(anime, expected) {
+		t.Errorf("unexpected anime:\n%+v\nexpected:\n%+v", anime, expected)
+	}
+	// unknown identifiers are made readable, the medium picture is used when there is no large one
+	if anime, err = source.Anime(context.Background(), 1); err != nil {
+		t.Fatalf("can't get anime: %v", err)
+	}
+	if anime.Type != "TV Special" || anime.Status != "On hiatus" || anime.Source != "4-koma manga" ||
+		anime.Rating != "PG-13 - Teens 13 or older" || anime.Duration != "Unknown" ||
+		anime.ImageURL != "https://cdn.myanimelist.net/images/anime/1/1.jpg" || anime.Aired.From.Year() != 2023 {
+		t.Errorf("unexpected labels: %+v", anime)
+	}
+	// missing anime
+	if _, err = source.Anime(context.Background(), 404); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a not found error, got: %v", err)
+	}
+}
+
+func TestParseMALDate(t *testing.T) {
+	for date, expected := range map[string]time.Time{
+		"2021-04-02": time.Date(2021, time.April, 2, 0, 0, 0, 0, time.UTC),
+		"2021-04":    time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC),
+		"2021":       time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"":           {},
+		"April 2021": {},
+	} {
+		if parsed := parseMALDate(date); !parsed.Equal(expected) {
+			t.Errorf("'%s' parsed as %v, expected %v", date, parsed, expected)
+		}
+	}
+}
+
+func TestFormatEpisodeDuration(t *testing.T) {
+	for _, tc := range []struct {
+		seconds, episodes int
+		expected          string
+	}{
+		{seconds: 1440, episodes: 12, expected: "24 min per ep"},
+		{seconds: 1440, episodes: 0, expected: "24 min per ep"},
+		{seconds: 6300, episodes: 1, expected: "1 hr 45 min"},
+		{seconds: 7200, episodes: 1, expected: "2 hr"},
+		{seconds: 45, episodes: 3, expected: "45 sec per ep"},
+		{seconds: 0, episodes: 12, expected: "Unknown"},
+	} {
+		if duration := formatEpisodeDuration(tc.seconds, tc.episodes); duration != tc.expected {
+			t.Errorf("%d seconds for %d episode(s) formatted as '%s', expected '%s'", tc.seconds, tc.episodes, duration, tc.expected)
+		}
+	}
+}
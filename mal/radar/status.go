@@ -0,0 +1,228 @@
+package radar
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrBatchPending is returned when a batch is requested while another one is already waiting to start
+	ErrBatchPending = errors.New("a batch is already pending")
+)
+
+// BatchResult describes the outcome of a batch
+type BatchResult struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Rebuild         bool      `json:"rebuild"`
+	Error           string    `json:"error,omitempty"`
+	// Finished is the number of finished animes processed by the notifiers
+	Finished int `json:"finished"`
+	// Tracked is the size of the watch list at the end of the batch
+	Tracked int `json:"tracked"`
+}
+
+// Status is a snapshot of the controller activity
+type Status struct {
+	Running      bool         `json:"running"`
+	RunningSince *time.Time   `json:"running_since,omitempty"`
+	Pending      bool         `json:"pending"`
+	LastBatch    *BatchResult `json:"last_batch,omitempty"`
+	LastSuccess  *time.Time   `json:"last_success,omitempty"`
+	NextBatch    time.Time    `json:"next_batch"`
+	Tracked      int          `json:"tracked"`
+	Profiles     []string     `json:"profiles"`
+	Storage      string       `json:"storage"`
+}
+
+// WatchedAnime is an anime of the watch list
+type WatchedAnime struct {
+	MalID       int                            `json:"mal_id"`
+	Title       string                         `json:"title"`
+	Status      string                         `json:"status"`
+	FirstSeen   time.Time                      `json:"first_seen"`
+	LastChecked time.Time                      `json:"last_checked"`
+	LastScore   float64                        `json:"last_score"`
+	Failures    int                            `json:"failures"`
+	FinishedAt  *time.Time                     `json:"finished_at,omitempty"`
+	ImageURL    string                         `json:"image_url,omitempty"`
+	Profiles    map[string]WatchedAnimeProfile `json:"profiles,omitempty"`
+	// Filters are only available once the anime details have been fetched since the start of the process
+	Filters map[string]FilterPreview `json:"filters,omitempty"`
+}
+
+// WatchedAnimeProfile is the processing state of a finished anime for a profile
+type WatchedAnimeProfile struct {
+	LastDecision  string `json:"last_decision,omitempty"`
+	Done          bool   `json:"done"`
+	Notifications int    `json:"notifications"`
+}
+
+// FilterPreview is the decision the filters of a profile would take with the last fetched details of an anime
+type FilterPreview struct {
+	Pass    bool     `json:"pass"`
+	Rule    string   `json:"rule"`
+	Reasons []string `json:"reasons"`
+}
+
+// NotificationLog is a notification attempt. Notifier is empty when only the successful delivery is known.
+type NotificationLog struct {
+	MalID    int       `json:"mal_id"`
+	Profile  string    `json:"profile"`
+	Title    string    `json:"title"`
+	Notifier string    `json:"notifier,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Date     time.Time `json:"date"`
+}
+
+// Encountered lists the values encountered while fetching animes details, useful to write filters
+type Encountered struct {
+	Genres  []string `json:"genres"`
+	Ratings []string `json:"ratings"`
+	Types   []string `json:"types"`
+}
+
+// Status returns a snapshot of the controller activity
+func (c *Controller) Status() (status Status) {
+	c.activity.Lock()
+	status.Running = !c.runningSince.IsZero()
+	if status.Running {
+		since := c.runningSince
+		status.RunningSince = &since
+	}
+	if c.lastBatch != nil {
+		result := *c.lastBatch
+		status.LastBatch = &result
+	}
+	if !c.lastSuccess.IsZero() {
+		lastSuccess := c.lastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+	status.NextBatch = c.nextBatch
+	c.activity.Unlock()
+	status.Pending = len(c.trigger) > 0
+	c.update.Lock()
+	status.Tracked = len(c.watchList)
+	c.update.Unlock()
+	status.Profiles = make([]string, len(c.profiles))
+	for index, p := range c.profiles {
+		status.Profiles[index] = p.name
+	}
+	status.Storage = c.store.name()
+	return
+}
+
+// WatchList returns the animes currently tracked, sorted by MalID
+func (c *Controller) WatchList() (animes []WatchedAnime) {
+	c.update.Lock()
+	defer c.update.Unlock()
+	animes = make([]WatchedAnime, 0, len(c.watchList))
+	for malID, state := range c.watchList {
+		anime := WatchedAnime{
+			MalID:       malID,
+			Title:       state.Title,
+			Status:      state.Status,
+			FirstSeen:   state.FirstSeen,
+			LastChecked: state.LastChecked,
+			LastScore:   state.LastScore,
+			Failures:    state.Failures,
+			ImageURL:    state.ImageURL,
+		}
+		if !state.FinishedAt.IsZero() {
+			finishedAt := state.FinishedAt
+			anime.FinishedAt = &finishedAt
+		}
+		if len(state.Profiles) > 0 {
+			anime.Profiles = make(map[string]WatchedAnimeProfile, len(state.Profiles))
+			for name, ps := range state.Profiles {
+				anime.Profiles[name] = WatchedAnimeProfile{
+					LastDecision:  ps.LastDecision,
+					Done:          ps.Done,
+					Notifications: len(ps.Notifications),
+				}
+			}
+		}
+		if state.details != nil {
+			anime.Filters = make(map[string]FilterPreview, len(c.profiles))
+			for _, p := range c.profiles {
+				decision := p.filters.evaluate(state.details)
+				anime.Filters[p.name] = FilterPreview{
+					Pass:    decision.notify,
+					Rule:    decision.rule,
+					Reasons: decision.reasons,
+				}
+			}
+		}
+		animes = append(animes, anime)
+	}
+	sort.Slice(animes, func(i, j int) bool {
+		return animes[i].MalID < animes[j].MalID
+	})
+	return
+}
+
+// Encountered returns the genres, ratings and types encountered so far
+func (c *Controller) Encountered() Encountered {
+	c.update.Lock()
+	defer c.update.Unlock()
+	return Encountered{
+		Genres:  c.genres.Sorted(),
+		Ratings: c.ratings.Sorted(),
+		Types:   c.types.Sorted(),
+	}
+}
+
+// RecentNotifications returns up to limit notifications, most recent first
+func (c *Controller) RecentNotifications(limit int) (notifications []NotificationLog, err error) {
+	c.update.Lock()
+	defer c.update.Unlock()
+	return c.store.recentNotifications(limit)
+}
+
+// TriggerBatch asks the watcher to start a new batch as soon as possible
+func (c *Controller) TriggerBatch() error {
+	select {
+	case c.trigger <- false:
+		c.log.Info("[MAL] batch requested")
+		return nil
+	default:
+		return ErrBatchPending
+	}
+}
+
+// ForceRebuild asks the watcher to drop the current watch list and to build it again from scratch
+// as soon as possible. Already notified animes are not notified again thanks to the sent notifications ledger.
+func (c *Controller) ForceRebuild() error {
+	select {
+	case c.trigger <- true:
+		c.log.Info("[MAL] watch list rebuild requested")
+		return nil
+	default:
+		return ErrBatchPending
+	}
+}
+
+func (c *Controller) batchStarted(start time.Time) {
+	c.activity.Lock()
+	c.runningSince = start
+	c.activity.Unlock()
+}
+
+func (c *Controller) batchEnded(result BatchResult) {
+	c.update.Lock()
+	result.Tracked = len(c.watchList)
+	c.update.Unlock()
+	c.activity.Lock()
+	c.runningSince = time.Time{}
+	c.lastBatch = &result
+	if result.Error == "" {
+		c.lastSuccess = result.Start
+	}
+	c.activity.Unlock()
+	c.metrics.batchEnded(result)
+	if result.Error == "" {
+		c.persistSchedule()
+	}
+}
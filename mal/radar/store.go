@@ -0,0 +1,191 @@
+package radar
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/hekmon/hllogger"
+)
+
+const (
+	// StorageJSON keeps the state as JSON files within the state directory
+	StorageJSON = "json"
+	// StorageSQLite keeps the state and its history within an embedded SQLite database
+	StorageSQLite = "sqlite"
+	// sqliteFile is the default database file name within the state directory
+	sqliteFile = "malradar.db"
+)
+
+// StorageConfig selects and configures the persistence backend
+type StorageConfig struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+}
+
+// storeState is the in memory state persisted by a store
+type storeState struct {
+	watchList map[int]*animeState
+	genres    UniqList
+	ratings   UniqList
+	types     UniqList
+}
+
+// store is a persistence backend for the controller state.
+// Full saves are used at stop and on demand while the incremental methods
+// allow backends supporting it to record changes (and their history) as they happen.
+type store interface {
+	name() string
+	// load returns the previously saved state. A nil watch list means the initial list must be built.
+	load() (storeState, error)
+	// save persists the whole state
+	save(state storeState) error
+	// incremental updates
+	saveAnime(malID int, state *animeState) error
+	deleteAnime(malID int, reason string) error
+	recordTransition(malID int, title, from, to string) error
+	recordDecision(malID int, profile, title, decision string) error
+	recordNotification(malID int, profile, title string, record notificationRecord) error
+	// sent notifications ledger, sentNotification returns a zero date if the anime has not been notified for profile
+	sentNotification(malID int, profile string) (time.Time, error)
+	recordSent(entry ledgerEntry) error
+	// recentNotifications returns up to limit notifications, most recent first
+	recentNotifications(limit int) ([]NotificationLog, error)
+	// initial list building progress, loadCheckpoint returns nil if there is none
+	loadCheckpoint() (*buildCheckpoint, error)
+	saveCheckpoint(checkpoint *buildCheckpoint) error
+	clearCheckpoint() error
+	// batches scheduling, loadSchedule returns a zero state if there is none
+	loadSchedule() (scheduleState, error)
+	saveSchedule(state scheduleState) error
+	close() error
+}
+
+func newStore(conf StorageConfig, stateDir string, logger *hllogger.HlLogger) (s store, err error) {
+	switch conf.Backend {
+	case "", StorageJSON:
+		return newJSONStore(stateDir, logger), nil
+	case StorageSQLite:
+		path := conf.Path
+		if path == "" {
+			path = sqliteFile
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(stateDir, path)
+		}
+		return newSQLiteStore(path, logger)
+	default:
+		return nil, fmt.Errorf("unknown storage backend '%s' (valid values are '%s' and '%s')",
+			conf.Backend, StorageJSON, StorageSQLite)
+	}
+}
+
+// persistAnime records the current state of an anime within the store.
+// c.update must be held by the caller.
+func (c *Controller) persistAnime(malID int) {
+	state := c.watchList[malID]
+	if state == nil {
+		return
+	}
+	if err := c.store.saveAnime(malID, state); err != nil {
+		c.log.Errorf("[MAL] [Store] can't save '%s' (MalID %d): %v", state.Title, malID, err)
+	}
+}
+
+// dropAnime removes an anime from the watch list and the store.
+// c.update must be held by the caller.
+func (c *Controller) dropAnime(malID int, reason string) {
+	delete(c.watchList, malID)
+	if err := c.store.deleteAnime(malID, reason); err != nil {
+		c.log.Errorf("[MAL] [Store] can't delete MalID %d: %v", malID, err)
+	}
+}
+
+// persistTransition records a status change of an anime.
+// c.update must be held by the caller.
+func (c *Controller) persistTransition(malID int, from string) {
+	state := c.watchList[malID]
+	if state == nil || state.Status == from {
+		return
+	}
+	if err := c.store.recordTransition(malID, state.Title, from, state.Status); err != nil {
+		c.log.Errorf("[MAL] [Store] can't record '%s' (MalID %d) status transition: %v", state.Title, malID, err)
+	}
+	c.persistAnime(malID)
+}
+
+// persistDecision records the last filter decision of an anime for a profile.
+// c.update must be held by the caller.
+func (c *Controller) persistDecision(malID int, profile, title string) {
+	state := c.watchList[malID]
+	if state == nil {
+		return
+	}
+	if err := c.store.recordDecision(malID, profile, title, state.profile(profile).LastDecision); err != nil {
+		c.log.Errorf("[MAL] [Store] can't record '%s' (MalID %d) filter decision for profile '%s': %v", title, malID, profile, err)
+	}
+	c.persistAnime(malID)
+}
+
+// load recovers the state from the store. When starting with an empty sqlite database,
+// the state and the sent notifications ledger of a previous json installation are imported if available,
+// their files are then renamed to be imported only once.
+func (c *Controller) load() (proceed bool) {
+	state, err := c.store.load()
+	if err != nil {
+		c.log.Errorf("[MAL] [Store] can't load state from the %s backend: %v", c.store.name(), err)
+		return
+	}
+	if state.watchList == nil && c.store.name() != StorageJSON {
+		legacyStore := newJSONStore(c.stateDir, c.log)
+		legacy, err := legacyStore.load()
+		if err != nil {
+			c.log.Warningf("[MAL] [Store] can't check for a previous json state to import: %v", err)
+		} else {
+			if legacy.watchList != nil {
+				c.log.Infof("[MAL] [Store] importing %d anime(s) from the previous json state into the %s backend",
+					len(legacy.watchList), c.store.name())
+				if err = c.store.save(legacy); err != nil {
+					c.log.Errorf("[MAL] [Store] can't import previous json state: %v", err)
+					return
+				}
+				state = legacy
+			}
+			if len(legacyStore.sent) > 0 {
+				c.log.Infof("[MAL] [Store] importing %d sent notification(s) from the previous json ledger into the %s backend",
+					len(legacyStore.sent), c.store.name())
+				for _, entry := range legacyStore.sent {
+					if err = c.store.recordSent(entry); err != nil {
+						c.log.Errorf("[MAL] [Store] can't import previous json sent notifications ledger: %v", err)
+						return
+					}
+				}
+			}
+			// recording is idempotent: if the import is interrupted, it can be done again safely at next start
+			if legacy.watchList != nil || len(legacyStore.sent) > 0 {
+				if err = legacyStore.markImported(); err != nil {
+					c.log.Warningf("[MAL] [Store] can't mark the previous json state as imported, it will be imported again at next start: %v", err)
+				} else {
+					c.log.Infof("[MAL] [Store] previous json state files renamed with the '%s' suffix", importedSuffix)
+				}
+			}
+		}
+	}
+	c.watchList = state.watchList
+	c.genres = state.genres
+	c.ratings = state.ratings
+	c.types = state.types
+	return true
+}
+
+func (c *Controller) saveState() {
+	err := c.store.save(storeState{
+		watchList: c.watchList,
+		genres:    c.genres,
+		ratings:   c.ratings,
+		types:     c.types,
+	})
+	if err != nil {
+		c.log.Errorf("[MAL] [Store] can't save state with the %s backend: %v", c.store.name(), err)
+	}
+}
@@ -0,0 +1,538 @@
+package radar
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hekmon/hllogger"
+	_ "modernc.org/sqlite" // pure go sqlite driver
+)
+
+const (
+	// sqliteSchemaVersion is the current version of the database schema
+	sqliteSchemaVersion = 1
+	// sqliteTimeFormat is used to store dates as UTC text: fixed width keeps them sortable
+	// and usable with the sqlite date functions
+	sqliteTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+)
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS meta (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	// animes rows are kept after their removal from the watch list for reporting
+	`CREATE TABLE IF NOT EXISTS animes (
+		mal_id         INTEGER PRIMARY KEY,
+		title          TEXT NOT NULL,
+		status         TEXT NOT NULL,
+		first_seen     TEXT,
+		last_checked   TEXT,
+		last_score     REAL NOT NULL DEFAULT 0,
+		failures       INTEGER NOT NULL DEFAULT 0,
+		finished_at    TEXT,
+		image_url      TEXT NOT NULL DEFAULT '',
+		removed_at     TEXT,
+		removed_reason TEXT NOT NULL DEFAULT ''
+	)`,
+	// per profile processing state of the tracked animes
+	`CREATE TABLE IF NOT EXISTS anime_profiles (
+		mal_id        INTEGER NOT NULL,
+		profile       TEXT NOT NULL,
+		last_decision TEXT NOT NULL DEFAULT '',
+		done          INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (mal_id, profile)
+	)`,
+	`CREATE TABLE IF NOT EXISTS transitions (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		mal_id      INTEGER NOT NULL,
+		title       TEXT NOT NULL,
+		from_status TEXT NOT NULL,
+		to_status   TEXT NOT NULL,
+		date        TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS decisions (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		mal_id   INTEGER NOT NULL,
+		profile  TEXT NOT NULL,
+		title    TEXT NOT NULL,
+		decision TEXT NOT NULL,
+		date     TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS notifications (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		mal_id   INTEGER NOT NULL,
+		profile  TEXT NOT NULL,
+		title    TEXT NOT NULL,
+		notifier TEXT NOT NULL,
+		error    TEXT NOT NULL DEFAULT '',
+		date     TEXT NOT NULL
+	)`,
+	// sent notifications ledger: an anime is notified at most once per profile
+	`CREATE TABLE IF NOT EXISTS sent_notifications (
+		mal_id  INTEGER NOT NULL,
+		profile TEXT NOT NULL,
+		title   TEXT NOT NULL,
+		date    TEXT NOT NULL,
+		PRIMARY KEY (mal_id, profile)
+	)`,
+	`CREATE TABLE IF NOT EXISTS encountered (
+		kind  TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (kind, value)
+	)`,
+	// progress of an interrupted initial list building
+	`CREATE TABLE IF NOT EXISTS checkpoint (
+		id   INTEGER PRIMARY KEY CHECK (id = 1),
+		data TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS transitions_mal_id ON transitions (mal_id)`,
+	`CREATE INDEX IF NOT EXISTS decisions_mal_id ON decisions (mal_id)`,
+	`CREATE INDEX IF NOT EXISTS notifications_mal_id ON notifications (mal_id)`,
+}
+
+const (
+	encounteredGenre  = "genre"
+	encounteredRating = "rating"
+	encounteredType   = "type"
+)
+
+// sqliteStore keeps the state and its history within an embedded SQLite database.
+// Each change is recorded within its own transaction as it happens.
+type sqliteStore struct {
+	path string
+	db   *sql.DB
+	log  *hllogger.HlLogger
+}
+
+func newSQLiteStore(path string, logger *hllogger.HlLogger) (ss *sqliteStore, err error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("can't open sqlite database %s: %w", path, err)
+	}
+	// a single connection avoids SQLITE_BUSY errors between our own writers
+	db.SetMaxOpenConns(1)
+	ss = &sqliteStore{
+		path: path,
+		db:   db,
+		log:  logger,
+	}
+	if err = ss.init(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't initialize sqlite database %s: %w", path, err)
+	}
+	logger.Infof("[MAL] [Store] using sqlite database %s", path)
+	return
+}
+
+func (ss *sqliteStore) init() (err error) {
+	return ss.transaction(func(tx *sql.Tx) (err error) {
+		for _, statement := range sqliteSchema {
+			if _, err = tx.Exec(statement); err != nil {
+				return
+			}
+		}
+		var version int
+		err = tx.QueryRow("SELECT value FROM meta WHERE key = 'schema_version'").Scan(&version)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_, err = tx.Exec("INSERT INTO meta (key, value) VALUES ('schema_version', ?)", sqliteSchemaVersion)
+			return
+		case err != nil:
+			return
+		case version != sqliteSchemaVersion:
+			return fmt.Errorf("unsupported schema version %d (current version is %d)", version, sqliteSchemaVersion)
+		}
+		return
+	})
+}
+
+func (ss *sqliteStore) name() string {
+	return StorageSQLite
+}
+
+func (ss *sqliteStore) load() (state storeState, err error) {
+	state.genres = make(UniqList)
+	state.ratings = make(UniqList)
+	state.types = make(UniqList)
+	// tracked animes
+	rows, err := ss.db.Query(`SELECT mal_id, title, status, first_seen, last_checked, last_score, failures, finished_at, image_url
+		FROM animes WHERE removed_at IS NULL`)
+	if err != nil {
+		return state, fmt.Errorf("can't query animes: %w", err)
+	}
+	defer rows.Close()
+	watchList := make(map[int]*animeState)
+	for rows.Next() {
+		var (
+			malID                              int
+			anime                              animeState
+			firstSeen, lastChecked, finishedAt sql.NullString
+		)
+		if err = rows.Scan(&malID, &anime.Title, &anime.Status, &firstSeen, &lastChecked,
+			&anime.LastScore, &anime.Failures, &finishedAt, &anime.ImageURL); err != nil {
+			return state, fmt.Errorf("can't read anime row: %w", err)
+		}
+		anime.FirstSeen = parseSQLiteTime(firstSeen)
+		anime.LastChecked = parseSQLiteTime(lastChecked)
+		anime.FinishedAt = parseSQLiteTime(finishedAt)
+		watchList[malID] = &anime
+	}
+	if err = rows.Err(); err != nil {
+		return state, fmt.Errorf("can't read animes: %w", err)
+	}
+	rows.Close()
+	// profiles state of the tracked animes
+	rows, err = ss.db.Query(`SELECT p.mal_id, p.profile, p.last_decision, p.done FROM anime_profiles p
+		JOIN animes a ON a.mal_id = p.mal_id AND a.removed_at IS NULL`)
+	if err != nil {
+		return state, fmt.Errorf("can't query animes profiles: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			malID   int
+			profile string
+			ps      profileState
+		)
+		if err = rows.Scan(&malID, &profile, &ps.LastDecision, &ps.Done); err != nil {
+			return state, fmt.Errorf("can't read anime profile row: %w", err)
+		}
+		if anime := watchList[malID]; anime != nil {
+			*anime.profile(profile) = ps
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return state, fmt.Errorf("can't read animes profiles: %w", err)
+	}
+	rows.Close()
+	// notifications attempts of the tracked animes
+	rows, err = ss.db.Query(`SELECT n.mal_id, n.profile, n.notifier, n.error, n.date FROM notifications n
+		JOIN animes a ON a.mal_id = n.mal_id AND a.removed_at IS NULL
+		WHERE a.first_seen IS NULL OR n.date >= a.first_seen ORDER BY n.id`)
+	if err != nil {
+		return state, fmt.Errorf("can't query notifications: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			malID   int
+			profile string
+			record  notificationRecord
+			date    sql.NullString
+		)
+		if err = rows.Scan(&malID, &profile, &record.Notifier, &record.Error, &date); err != nil {
+			return state, fmt.Errorf("can't read notification row: %w", err)
+		}
+		record.Date = parseSQLiteTime(date)
+		if anime := watchList[malID]; anime != nil {
+			ps := anime.profile(profile)
+			ps.Notifications = append(ps.Notifications, record)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return state, fmt.Errorf("can't read notifications: %w", err)
+	}
+	rows.Close()
+	// encountered values
+	rows, err = ss.db.Query("SELECT kind, value FROM encountered")
+	if err != nil {
+		return state, fmt.Errorf("can't query encountered values: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, value string
+		if err = rows.Scan(&kind, &value); err != nil {
+			return state, fmt.Errorf("can't read encountered value row: %w", err)
+		}
+		switch kind {
+		case encounteredGenre:
+			state.genres.Add(value)
+		case encounteredRating:
+			state.ratings.Add(value)
+		case encounteredType:
+			state.types.Add(value)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return state, fmt.Errorf("can't read encountered values: %w", err)
+	}
+	// an empty database means the initial list must be built
+	if len(watchList) > 0 {
+		state.watchList = watchList
+	}
+	ss.log.Infof("[MAL] [Store] state loaded from %s: %d tracked anime(s)", ss.path, len(watchList))
+	return
+}
+
+func (ss *sqliteStore) save(state storeState) (err error) {
+	err = ss.transaction(func(tx *sql.Tx) (err error) {
+		// tracked animes
+		if len(state.watchList) > 0 {
+			for malID, anime := range state.watchList {
+				if err = upsertAnime(tx, malID, anime); err != nil {
+					return
+				}
+			}
+			// animes tracked within the database but not anymore in memory
+			var rows *sql.Rows
+			if rows, err = tx.Query("SELECT mal_id FROM animes WHERE removed_at IS NULL"); err != nil {
+				return
+			}
+			var stale []int
+			for rows.Next() {
+				var malID int
+				if err = rows.Scan(&malID); err != nil {
+					rows.Close()
+					return
+				}
+				if _, found := state.watchList[malID]; !found {
+					stale = append(stale, malID)
+				}
+			}
+			rows.Close()
+			if err = rows.Err(); err != nil {
+				return
+			}
+			for _, malID := range stale {
+				if err = markRemoved(tx, malID, "no longer within the watch list"); err != nil {
+					return
+				}
+			}
+		} else {
+			// next run will need to build the initial list
+			ss.log.Debug("[MAL] [Store] saving animes skipped: next start must initial list building")
+		}
+		// encountered values
+		for kind, values := range map[string]UniqList{
+			encounteredGenre:  state.genres,
+			encounteredRating: state.ratings,
+			encounteredType:   state.types,
+		} {
+			for value := range values {
+				if _, err = tx.Exec("INSERT OR IGNORE INTO encountered (kind, value) VALUES (?, ?)", kind, value); err != nil {
+					return
+				}
+			}
+		}
+		return
+	})
+	if err == nil {
+		ss.log.Infof("[MAL] [Store] state saved to %s", ss.path)
+	}
+	return
+}
+
+func (ss *sqliteStore) saveAnime(malID int, state *animeState) error {
+	return ss.transaction(func(tx *sql.Tx) error {
+		return upsertAnime(tx, malID, state)
+	})
+}
+
+func (ss *sqliteStore) deleteAnime(malID int, reason string) error {
+	return ss.transaction(func(tx *sql.Tx) error {
+		return markRemoved(tx, malID, reason)
+	})
+}
+
+func (ss *sqliteStore) recordTransition(malID int, title, from, to string) error {
+	return ss.transaction(func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec("INSERT INTO transitions (mal_id, title, from_status, to_status, date) VALUES (?, ?, ?, ?, ?)",
+			malID, title, from, to, formatSQLiteTime(time.Now()))
+		return
+	})
+}
+
+func (ss *sqliteStore) recordDecision(malID int, profile, title, decision string) error {
+	return ss.transaction(func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec("INSERT INTO decisions (mal_id, profile, title, decision, date) VALUES (?, ?, ?, ?, ?)",
+			malID, profile, title, decision, formatSQLiteTime(time.Now()))
+		return
+	})
+}
+
+func (ss *sqliteStore) recordNotification(malID int, profile, title string, record notificationRecord) error {
+	return ss.transaction(func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec("INSERT INTO notifications (mal_id, profile, title, notifier, error, date) VALUES (?, ?, ?, ?, ?, ?)",
+			malID, profile, title, record.Notifier, record.Error, formatSQLiteTime(record.Date))
+		return
+	})
+}
+
+func (ss *sqliteStore) sentNotification(malID int, profile string) (date time.Time, err error) {
+	var value sql.NullString
+	err = ss.db.QueryRow("SELECT date FROM sent_notifications WHERE mal_id = ? AND profile = ?", malID, profile).Scan(&value)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return date, nil
+	case err != nil:
+		return date, fmt.Errorf("can't query sent notifications: %w", err)
+	}
+	return parseSQLiteTime(value), nil
+}
+
+func (ss *sqliteStore) recordSent(entry ledgerEntry) error {
+	return ss.transaction(func(tx *sql.Tx) (err error) {
+		// keep the first notification date
+		_, err = tx.Exec("INSERT OR IGNORE INTO sent_notifications (mal_id, profile, title, date) VALUES (?, ?, ?, ?)",
+			entry.MalID, entry.Profile, entry.Title, formatSQLiteTime(entry.Date))
+		return
+	})
+}
+
+func (ss *sqliteStore) recentNotifications(limit int) (notifications []NotificationLog, err error) {
+	rows, err := ss.db.Query("SELECT mal_id, profile, title, notifier, error, date FROM notifications ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't query notifications: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			notification NotificationLog
+			date         sql.NullString
+		)
+		if err = rows.Scan(&notification.MalID, &notification.Profile, &notification.Title, &notification.Notifier,
+			&notification.Error, &date); err != nil {
+			return nil, fmt.Errorf("can't read notification row: %w", err)
+		}
+		notification.Date = parseSQLiteTime(date)
+		notifications = append(notifications, notification)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("can't read notifications: %w", err)
+	}
+	return
+}
+
+func (ss *sqliteStore) loadSchedule() (state scheduleState, err error) {
+	var data string
+	if err = ss.db.QueryRow("SELECT value FROM meta WHERE key = 'schedule'").Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return state, nil
+		}
+		return state, fmt.Errorf("can't query schedule: %w", err)
+	}
+	if err = json.Unmarshal([]byte(data), &state); err != nil {
+		return state, fmt.Errorf("can't decode schedule: %w", err)
+	}
+	return
+}
+
+func (ss *sqliteStore) saveSchedule(state scheduleState) (err error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("can't encode schedule: %w", err)
+	}
+	_, err = ss.db.Exec("INSERT INTO meta (key, value) VALUES ('schedule', ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", string(data))
+	return
+}
+
+func (ss *sqliteStore) close() error {
+	return ss.db.Close()
+}
+
+func (ss *sqliteStore) loadCheckpoint() (checkpoint *buildCheckpoint, err error) {
+	var data string
+	if err = ss.db.QueryRow("SELECT data FROM checkpoint WHERE id = 1").Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("can't query checkpoint: %w", err)
+	}
+	if err = json.Unmarshal([]byte(data), &checkpoint); err != nil {
+		return nil, fmt.Errorf("can't decode checkpoint: %w", err)
+	}
+	return
+}
+
+func (ss *sqliteStore) saveCheckpoint(checkpoint *buildCheckpoint) (err error) {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("can't encode checkpoint: %w", err)
+	}
+	_, err = ss.db.Exec("INSERT INTO checkpoint (id, data) VALUES (1, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data", string(data))
+	return
+}
+
+func (ss *sqliteStore) clearCheckpoint() (err error) {
+	_, err = ss.db.Exec("DELETE FROM checkpoint")
+	return
+}
+
+func (ss *sqliteStore) transaction(fn func(tx *sql.Tx) error) (err error) {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("can't start transaction: %w", err)
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+	return
+}
+
+func upsertAnime(tx *sql.Tx, malID int, state *animeState) (err error) {
+	_, err = tx.Exec(`INSERT INTO animes (mal_id, title, status, first_seen, last_checked, last_score, failures, finished_at, image_url)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (mal_id) DO UPDATE SET
+			title = excluded.title,
+			status = excluded.status,
+			first_seen = excluded.first_seen,
+			last_checked = excluded.last_checked,
+			last_score = excluded.last_score,
+			failures = excluded.failures,
+			finished_at = excluded.finished_at,
+			image_url = excluded.image_url,
+			removed_at = NULL,
+			removed_reason = ''`,
+		malID, state.Title, state.Status, formatSQLiteTime(state.FirstSeen), formatSQLiteTime(state.LastChecked),
+		state.LastScore, state.Failures, formatSQLiteTime(state.FinishedAt), state.ImageURL)
+	if err != nil {
+		return fmt.Errorf("can't upsert MalID %d: %w", malID, err)
+	}
+	for profile, ps := range state.Profiles {
+		_, err = tx.Exec(`INSERT INTO anime_profiles (mal_id, profile, last_decision, done) VALUES (?, ?, ?, ?)
+			ON CONFLICT (mal_id, profile) DO UPDATE SET
+				last_decision = excluded.last_decision,
+				done = excluded.done`,
+			malID, profile, ps.LastDecision, ps.Done)
+		if err != nil {
+			return fmt.Errorf("can't upsert MalID %d profile '%s': %w", malID, profile, err)
+		}
+	}
+	return
+}
+
+func markRemoved(tx *sql.Tx, malID int, reason string) (err error) {
+	_, err = tx.Exec("UPDATE animes SET removed_at = ?, removed_reason = ? WHERE mal_id = ? AND removed_at IS NULL",
+		formatSQLiteTime(time.Now()), reason, malID)
+	if err != nil {
+		return fmt.Errorf("can't mark MalID %d as removed: %w", malID, err)
+	}
+	// the history is kept within the decisions and notifications tables
+	if _, err = tx.Exec("DELETE FROM anime_profiles WHERE mal_id = ?", malID); err != nil {
+		return fmt.Errorf("can't delete MalID %d profiles state: %w", malID, err)
+	}
+	return
+}
+
+func formatSQLiteTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+func parseSQLiteTime(value sql.NullString) (t time.Time) {
+	if !value.Valid {
+		return
+	}
+	t, _ = time.Parse(sqliteTimeFormat, value.String)
+	return
+}
@@ -0,0 +1,127 @@
+package radar
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultTitleTemplate   = `{{ .Title }}`
+	defaultMessageTemplate = `<b>Score</b>
+{{ printf "%.2f" .Anime.Score }} ({{ .Anime.ScoredBy }} votes) ranked #{{ .Anime.Rank }}
+<b>Episodes</b>
+{{ .Anime.Episodes }} {{ .Anime.Type }} ({{ .Anime.Duration }})
+<b>Studios</b>
+{{ join .Studios ", " }}
+<b>Genres</b>
+{{ join .Genres ", " }}
+<b>Rating</b>
+{{ .Anime.Rating }}`
+	defaultURLTitleTemplate = `Check it on MyAnimeList`
+)
+
+var (
+	templatesFuncs = template.FuncMap{
+		"join":     strings.Join,
+		"truncate": truncate,
+	}
+	defaultTemplates, _ = LoadTemplates(TemplatesConfig{})
+)
+
+// TemplatesConfig contains the paths of the user template files used to render the notifications.
+// Empty values fallback to the default templates.
+type TemplatesConfig struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	URLTitle string `json:"url_title"`
+}
+
+// Templates holds the parsed templates used to render the notifications
+type Templates struct {
+	title    *template.Template
+	message  *template.Template
+	urlTitle *template.Template
+}
+
+// TemplateData is the data model passed to the notifications templates
+type TemplateData struct {
+	// Anime contains all the details fetched from MyAnimeList
+	Anime *Anime
+	// Title is the english title if available, the main title otherwise
+	Title string
+	// LargeImageURL is the URL of the large version of the anime cover (can be empty)
+	LargeImageURL string
+	// Studios contains the names of the anime studios
+	Studios []string
+	// Genres contains the names of the anime genres
+	Genres []string
+	// UserListStatus is the status of the anime on the checked MAL user list ("Plan to Watch" for example),
+	// empty if the anime is not on the list or if no user is configured
+	UserListStatus string
+	// FilterReasons lists why the anime passed the filters
+	FilterReasons []string
+	// Profile is the name of the watch profile the notification is sent for
+	Profile string
+}
+
+// LoadTemplates reads and parses the templates files referenced in conf
+func LoadTemplates(conf TemplatesConfig) (t *Templates, err error) {
+	t = new(Templates)
+	if t.title, err = loadTemplate("title", conf.Title, defaultTitleTemplate); err != nil {
+		return
+	}
+	if t.message, err = loadTemplate("message", conf.Message, defaultMessageTemplate); err != nil {
+		return
+	}
+	if t.urlTitle, err = loadTemplate("url_title", conf.URLTitle, defaultURLTitleTemplate); err != nil {
+		return
+	}
+	return
+}
+
+func loadTemplate(name, path, fallback string) (tmpl *template.Template, err error) {
+	content := fallback
+	if path != "" {
+		var data []byte
+		if data, err = ioutil.ReadFile(path); err != nil {
+			err = fmt.Errorf("can't read %s template file: %w", name, err)
+			return
+		}
+		content = string(data)
+	}
+	if tmpl, err = template.New(name).Funcs(templatesFuncs).Option("missingkey=error").Parse(content); err != nil {
+		err = fmt.Errorf("can't parse %s template: %w", name, err)
+	}
+	return
+}
+
+func (t *Templates) render(data TemplateData) (title, message, urlTitle string, err error) {
+	if title, err = execute(t.title, data); err != nil {
+		return
+	}
+	if message, err = execute(t.message, data); err != nil {
+		return
+	}
+	urlTitle, err = execute(t.urlTitle, data)
+	return
+}
+
+func execute(tmpl *template.Template, data TemplateData) (result string, err error) {
+	var buffer bytes.Buffer
+	if err = tmpl.Execute(&buffer, data); err != nil {
+		err = fmt.Errorf("can't execute %s template: %w", tmpl.Name(), err)
+		return
+	}
+	return strings.TrimSpace(buffer.String()), nil
+}
+
+func truncate(length int, text string) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:length])) + "…"
+}
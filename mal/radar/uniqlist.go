@@ -3,6 +3,7 @@ package radar
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 )
 
 // UniqList allows to uniquely store values while translating from and to JSON as a regular list
@@ -27,14 +28,24 @@ func (ul UniqList) MarshalJSON() (data []byte, err error) {
 }
 
 // UnmarshalJSON allows to transform a regular JSON array as a uniq lsit
-func (ul UniqList) UnmarshalJSON(data []byte) (err error) {
+func (ul *UniqList) UnmarshalJSON(data []byte) (err error) {
 	var flat []string
 	if err := json.Unmarshal(data, &flat); err != nil {
 		return fmt.Errorf("cannot unmarshal data wihtin the temporary flat list: %w", err)
 	}
-	ul = make(UniqList, len(flat))
+	*ul = make(UniqList, len(flat))
 	for _, item := range flat {
-		ul[item] = struct{}{}
+		(*ul)[item] = struct{}{}
 	}
 	return
 }
+
+// Sorted returns the items of the list in alphabetical order
+func (ul UniqList) Sorted() (items []string) {
+	items = make([]string, 0, len(ul))
+	for item := range ul {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return
+}
@@ -1,68 +1,151 @@
 package radar
 
 import (
+	"errors"
 	"fmt"
 	"time"
-
-	"github.com/darenliang/jikan-go"
 )
 
 const (
-	fetchFreq           = 24 * time.Hour
 	animeStatusNotAired = "Not yet aired"
 	animeStatusOnGoing  = "Currently Airing"
 	animeStatusFinished = "Finished Airing"
-	errorRetryMax       = 5
 )
 
 func (c *Controller) watcher() {
-	// create the ticker
-	ticker := time.NewTicker(fetchFreq)
-	defer ticker.Stop()
-	// start the first batch
-	c.batch()
-	// reexecute batch at each tick
+	next := c.firstBatch()
+	// execute batch when scheduled or when requested
 	for {
+		c.setNextBatch(next)
+		timer := time.NewTimer(time.Until(next))
 		select {
-		case <-ticker.C:
-			c.batch()
+		case <-timer.C:
+			c.batch(false)
+			// computing from the scheduled time avoids drifting with the batch duration
+			if next = c.schedule.next(next); !next.After(time.Now()) {
+				next = c.schedule.next(time.Now())
+			}
+			c.log.Infof("[MAL] [Watcher] next batch scheduled at %v", next.Format(time.RFC1123))
+		case rebuild := <-c.trigger:
+			timer.Stop()
+			c.batch(rebuild)
 		case <-c.ctx.Done():
+			timer.Stop()
 			c.log.Info("[MAL] [Watcher] context done: stopping worker")
 			return
 		}
 	}
 }
 
-func (c *Controller) batch() {
+func (c *Controller) batch(rebuild bool) {
 	start := time.Now()
 	c.log.Info("[MAL] [Watcher] starting new batch")
-	defer func() {
-		c.log.Infof("[MAL] [Watcher] batch executed in %v", time.Since(start))
-	}()
+	c.batchStarted(start)
 	var (
 		err      error
-		finished []*jikan.Anime
+		finished []*Anime
 	)
+	defer func() {
+		result := BatchResult{
+			Start:           start,
+			End:             time.Now(),
+			DurationSeconds: time.Since(start).Seconds(),
+			Rebuild:         rebuild,
+			Finished:        len(finished),
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		c.batchEnded(result)
+		c.log.Infof("[MAL] [Watcher] batch executed in %v", time.Since(start))
+	}()
+	// start over if requested
+	if rebuild {
+		c.log.Info("[MAL] [Watcher] rebuild requested: dropping the current watch list")
+		c.update.Lock()
+		c.watchList = nil
+		c.update.Unlock()
+		if err = c.store.clearCheckpoint(); err != nil {
+			c.log.Errorf("[MAL] [Watcher] can't clear initial list building checkpoint: %v", err)
+			err = nil
+		}
+	}
 	// first run or state update ?
 	if c.watchList == nil {
 		if finished, err = c.buildInitialList(); err != nil {
+			c.update.Lock()
 			c.watchList = nil
-			c.log.Errorf("[MAL] [Watcher] failed to build initial list: %v", err)
+			c.update.Unlock()
+			c.log.Errorf("[MAL] [Watcher] failed to build initial list (progress is kept for next attempt): %v", err)
 			return
 		}
+		// persist the freshly built list right away, progress is not needed anymore
+		c.update.Lock()
+		c.saveState()
+		c.update.Unlock()
+		if errCheckpoint := c.store.clearCheckpoint(); errCheckpoint != nil {
+			c.log.Errorf("[MAL] [Watcher] can't clear initial list building checkpoint: %v", errCheckpoint)
+		}
 	} else {
 		// try to recover previously finished animes not notified
 		finished = c.recoverOldFinished()
 		// update state of known animes & process the finished one
 		finished = append(finished, c.updateCurrentState()...)
 		// try to find new ones
-		c.findNewAnimes()
+		err = c.findNewAnimes()
 	}
 	// notify
 	c.batchNotifier(finished)
+	// the steps stop early when interrupted: such a batch must not be considered as completed
+	if err == nil && c.ctx.Err() != nil {
+		err = fmt.Errorf("batch interrupted: %w", c.ctx.Err())
+	}
 }
 
-func (c *Controller) buildInitialList() (finished []*jikan.Anime, err error) {
+const (
+	operationInitialList     = "initial_list"
+	operationRecoverFinished = "recover_finished"
+	operationUpdateState     = "update_state"
+	operationFindNew         = "find_new"
+	operationUserList        = "user_list"
+)
+
+// getAnime fetches the details of an anime from the source, retrying if it makes sense
+func (c *Controller) getAnime(operation string, malID int) (anime *Anime, err error) {
+	err = c.retry(operation, fmt.Sprintf("anime %d details", malID), func() (err error) {
+		anime, err = c.source.Anime(c.ctx, malID)
+		return
+	})
+	return
+}
+
+// getSeason fetches the animes of a season from the source, retrying if it makes sense
+func (c *Controller) getSeason(operation string, year int, season string) (list []*Anime, err error) {
+	err = c.retry(operation, fmt.Sprintf("%s %d season", season, year), func() (err error) {
+		list, err = c.source.Season(c.ctx, year, season)
+		return
+	})
+	return
+}
+
+// fetchFailed handles a tracked anime whose details can't be fetched: it is dropped from the watch list
+// if it does not exist anymore, its failures counter is increased otherwise.
+func (c *Controller) fetchFailed(malID int, state *animeState, err error) {
+	c.update.Lock()
+	defer c.update.Unlock()
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.log.Warningf("[MAL] [Watcher] '%s' (MalID %d) does not exist anymore: removing it from the watch list", state.Title, malID)
+		c.dropAnime(malID, "not found")
+	case c.ctx.Err() != nil:
+		// interrupted, not the anime fault
+	default:
+		state.Failures++
+		c.persistAnime(malID)
+	}
+}
+
+func (c *Controller) buildInitialList() (finished []*Anime, err error) {
 	var notifinit string
 	if c.notifyInit {
 		notifinit = "backlog notifications activated"
@@ -72,82 +155,110 @@ func (c *Controller) buildInitialList() (finished []*jikan.Anime, err error) {
 	c.log.Infof("[MAL] [Watcher] building initial list with a %d season(s) backlog and %s",
 		c.nbSeasons, notifinit)
 	var (
-		seasonList   *jikan.Season
-		animeDetails *jikan.Anime
+		seasonList   []*Anime
+		animeDetails *Anime
 		previousLen  int
 		found        bool
 	)
-	year, season := currentSeason()
-	for i := 0; i < c.nbSeasons; i++ {
+	// resume a previous attempt if any
+	checkpoint := c.resumeCheckpoint()
+	c.update.Lock()
+	c.watchList = checkpoint.Animes
+	c.update.Unlock()
+	if resumed := countStatus(c.watchList, animeStatusFinished); resumed > 0 {
+		c.log.Infof("[MAL] [Watcher] building initial list: %d '%s' anime(s) found by the previous attempt will be processed at next batch",
+			resumed, animeStatusFinished)
+	}
+	for i := checkpoint.Season; i < c.nbSeasons; i++ {
+		year, season := checkpoint.season(i)
 		previousLen = len(c.watchList)
 		// get season list
-		c.rateLimiter()
-		if seasonList, err = jikan.GetSeason(year, season); err != nil {
+		if seasonList, err = c.getSeason(operationInitialList, year, season); err != nil {
 			err = fmt.Errorf("iteration %d (%s %d): failing to acquire season animes: %w",
 				i+1, season, year, err)
 			return
 		}
 		c.log.Infof("[MAL] [Watcher] building initial list: season %d/%d (%s %d): fetching details for %d animes...",
-			i+1, c.nbSeasons, season, year, len(seasonList.Anime))
-		if c.watchList == nil {
-			c.watchList = make(map[int]string, c.nbSeasons*len(seasonList.Anime)*3/2) // ×1.5
+			i+1, c.nbSeasons, season, year, len(seasonList))
+		// resume within the season if needed
+		start := 0
+		if i == checkpoint.Season && checkpoint.Index > 0 {
+			if start = checkpoint.Index; start > len(seasonList) {
+				start = len(seasonList)
+			}
+			c.log.Infof("[MAL] [Watcher] building initial list: season %d/%d (%s %d): resuming at anime %d/%d",
+				i+1, c.nbSeasons, season, year, start+1, len(seasonList))
 		}
 		// for each anime
-		for index, anime := range seasonList.Anime {
+	anime:
+		for index := start; index < len(seasonList); index++ {
+			anime := seasonList[index]
+			// are we asked to stop ?
+			if c.ctx.Err() != nil {
+				c.checkpoint(checkpoint, i, index)
+				err = fmt.Errorf("iteration %d (%s %d): interrupted at anime %d/%d: %w",
+					i+1, season, year, index+1, len(seasonList), c.ctx.Err())
+				return
+			}
+			if index > start && index%checkpointInterval == 0 {
+				c.checkpoint(checkpoint, i, index)
+			}
 			// do we have it from an earlier season ?
 			if _, found = c.watchList[anime.MalID]; found {
 				c.log.Debugf("[MAL] [Watcher] building initial list: season %d/%d (%s %d): anime %d/%d: '%s' (MalID %d): already in the list",
-					i+1, c.nbSeasons, season, year, index, len(seasonList.Anime), anime.Title, anime.MalID, animeDetails.Status)
+					i+1, c.nbSeasons, season, year, index, len(seasonList), anime.Title, anime.MalID)
 				continue
 			}
 			// get its details
-			try := 0
-			for {
-				// sometime the Jikkan API can have issues, we will retry until errorRetryMax is reached
-				try++
-				c.rateLimiter()
-				if animeDetails, err = jikan.GetAnime(anime.MalID); err == nil {
-					// no error let's get out of the loop
-					if try > 1 {
-						c.log.Infof("[MAL] [Watcher] building initial list: season %d/%d (%s %d): anime %d details recovered at try %d/%d",
-							i+1, c.nbSeasons, season, year, anime.MalID, try, errorRetryMax)
-					}
-					break
-				}
-				if try == errorRetryMax {
-					err = fmt.Errorf("iteration %d (%s %d): failed to acquire anime %d details (try %d/%d): %w",
-						i+1, season, year, anime.MalID, try, errorRetryMax, err)
-					return
+			if animeDetails, err = c.getAnime(operationInitialList, anime.MalID); err != nil {
+				switch {
+				case errors.Is(err, ErrNotFound):
+					c.log.Warningf("[MAL] [Watcher] building initial list: season %d/%d (%s %d): anime %d does not exist anymore: %v: leaving it out",
+						i+1, c.nbSeasons, season, year, anime.MalID, err)
+					err = nil
+					continue anime
+				case c.ctx.Err() == nil && c.initErrorPolicy == InitErrorSkip:
+					c.log.Errorf("[MAL] [Watcher] building initial list: season %d/%d (%s %d): failed to acquire anime details: %v: skipping it for now",
+						i+1, c.nbSeasons, season, year, err)
+					checkpoint.Skipped[anime.MalID] = err.Error()
+					err = nil
+					continue anime
 				}
-				// let's retry when rateLimiter will allow us to
-				c.log.Warningf("[MAL] [Watcher] building initial list: season %d/%d (%s %d): failed to acquire anime %d details (try %d/%d): %v",
-					i+1, c.nbSeasons, season, year, anime.MalID, try, errorRetryMax, err)
+				c.checkpoint(checkpoint, i, index)
+				err = fmt.Errorf("iteration %d (%s %d): failed to acquire anime details: %w", i+1, season, year, err)
+				return
 			}
 			// save data
-			c.update.Lock()
-			for _, genre := range animeDetails.Genres {
-				c.genres.Add(genre.Name)
-			}
-			c.ratings.Add(animeDetails.Rating)
-			c.types.Add(animeDetails.Type)
-			if animeDetails.Status == animeStatusFinished {
-				if c.notifyInit {
-					finished = append(finished, animeDetails)
-					c.watchList[anime.MalID] = animeDetails.Status
-				}
-				// else skip
-			} else {
-				c.watchList[anime.MalID] = animeDetails.Status
+			if c.addInitialAnime(animeDetails) {
+				finished = append(finished, animeDetails)
 			}
-			c.update.Unlock()
 			c.log.Debugf("[MAL] [Watcher] building initial list: season %d/%d (%s %d): anime %d/%d: '%s' (MalID %d) with '%s' state",
-				i+1, c.nbSeasons, season, year, index, len(seasonList.Anime), getTitle(animeDetails), animeDetails.MalID, animeDetails.Status)
+				i+1, c.nbSeasons, season, year, index, len(seasonList), getTitle(animeDetails), animeDetails.MalID, animeDetails.Status)
 		}
 		// season done
 		c.log.Infof("[MAL] [Watcher] building initial list: season %d/%d (%s %d): added %d/%d animes",
-			i+1, c.nbSeasons, season, year, len(c.watchList)-previousLen, len(seasonList.Anime))
-		// prepare for next run
-		year, season = previousSeason(season, year)
+			i+1, c.nbSeasons, season, year, len(c.watchList)-previousLen, len(seasonList))
+		c.checkpoint(checkpoint, i+1, 0)
+	}
+	// give a last chance to the skipped animes
+	if len(checkpoint.Skipped) > 0 {
+		c.log.Infof("[MAL] [Watcher] building initial list: trying again %d skipped anime(s)", len(checkpoint.Skipped))
+		for malID, reason := range checkpoint.Skipped {
+			if _, found = c.watchList[malID]; found {
+				continue
+			}
+			if animeDetails, err = c.getAnime(operationInitialList, malID); err != nil {
+				c.log.Errorf("[MAL] [Watcher] building initial list: anime %d details still can't be acquired (%v, previously: %s): leaving it out",
+					malID, err, reason)
+				err = nil
+				continue
+			}
+			if c.addInitialAnime(animeDetails) {
+				finished = append(finished, animeDetails)
+			}
+			c.log.Infof("[MAL] [Watcher] building initial list: previously skipped anime '%s' (MalID %d) recovered with '%s' state",
+				getTitle(animeDetails), malID, animeDetails.Status)
+		}
 	}
 	// send all the finished animes discovered
 	c.log.Infof("[MAL] [Watcher] building initial list: now tracking %d animes, %d '%s' to be processed",
@@ -155,41 +266,70 @@ func (c *Controller) buildInitialList() (finished []*jikan.Anime, err error) {
 	return
 }
 
-func (c *Controller) recoverOldFinished() (finished []*jikan.Anime) {
+// addInitialAnime registers the details of an anime discovered during the initial list building.
+// finished is true if the anime must be processed right away.
+func (c *Controller) addInitialAnime(animeDetails *Anime) (finished bool) {
+	c.update.Lock()
+	defer c.update.Unlock()
+	for _, genre := range animeDetails.Genres {
+		c.genres.Add(genre)
+	}
+	c.ratings.Add(animeDetails.Rating)
+	c.types.Add(animeDetails.Type)
+	if animeDetails.Status == animeStatusFinished {
+		if c.notifyInit {
+			c.watchList[animeDetails.MalID] = newAnimeState(animeDetails)
+			finished = true
+		}
+		// else skip
+	} else {
+		c.watchList[animeDetails.MalID] = newAnimeState(animeDetails)
+	}
+	return
+}
+
+func countStatus(watchList map[int]*animeState, status string) (count int) {
+	for _, state := range watchList {
+		if state.Status == status {
+			count++
+		}
+	}
+	return
+}
+
+func (c *Controller) recoverOldFinished() (finished []*Anime) {
 	c.log.Debugf("[MAL] [Watcher] recover old finished: checking %d animes...", len(c.watchList))
 	var (
 		err          error
-		animeDetails *jikan.Anime
+		animeDetails *Anime
 	)
-	finished = make([]*jikan.Anime, 0, len(c.watchList))
+	finished = make([]*Anime, 0, len(c.watchList))
 	index := 1
 	// try to recover of notified finished animes
 anime:
-	for malID, status := range c.watchList {
-		if status == animeStatusFinished {
+	for malID, state := range c.watchList {
+		// requests fail once the rate limiter is stopped, do not count them as anime failures
+		if c.ctx.Err() != nil {
+			c.log.Infof("[MAL] [Watcher] recover old finished: interrupted: %v", c.ctx.Err())
+			return
+		}
+		if state.Status == animeStatusFinished {
 			// Get details
-			try := 0
-			for {
-				// sometime the Jikkan API can have issues, we will retry until errorRetryMax is reached
-				try++
-				c.rateLimiter()
-				if animeDetails, err = jikan.GetAnime(malID); err == nil {
-					// no error let's get out of the loop
-					if try > 1 {
-						c.log.Infof("[MAL] [Watcher] recover old finished: [%d/%d] anime %d details recovered at try %d/%d",
-							index, len(c.watchList), malID, try, errorRetryMax)
-					}
-					break
-				}
-				if try == errorRetryMax {
-					c.log.Errorf("[MAL] [Watcher] recover old finished: [%d/%d] can't check current status of MalID %d (try %d/%d): %s",
-						index, len(c.watchList), malID, try, errorRetryMax, err)
-					continue anime
-				}
-				// let's retry when rateLimiter will allow us to
-				c.log.Warningf("[MAL] [Watcher] recover old finished: [%d/%d] can't check current status of MalID %d (try %d/%d): %s",
-					index, len(c.watchList), malID, try, errorRetryMax, err)
+			if animeDetails, err = c.getAnime(operationRecoverFinished, malID); err != nil {
+				c.log.Errorf("[MAL] [Watcher] recover old finished: [%d/%d] can't check current status of MalID %d: %v",
+					index, len(c.watchList), malID, err)
+				c.fetchFailed(malID, state, err)
+				index++
+				continue anime
+			}
+			c.update.Lock()
+			state.refresh(animeDetails)
+			// states loaded from legacy files do not have a finish time
+			if state.FinishedAt.IsZero() {
+				state.setFinished(animeDetails)
 			}
+			c.persistAnime(malID)
+			c.update.Unlock()
 			// save it for notification
 			finished = append(finished, animeDetails)
 		}
@@ -203,55 +343,53 @@ anime:
 	return
 }
 
-func (c *Controller) updateCurrentState() (finished []*jikan.Anime) {
+func (c *Controller) updateCurrentState() (finished []*Anime) {
 	c.log.Infof("[MAL] [Watcher] updating state: refreshing %d animes...", len(c.watchList))
 	var (
 		err          error
-		animeDetails *jikan.Anime
+		animeDetails *Anime
 	)
-	finished = make([]*jikan.Anime, 0, len(c.watchList))
+	finished = make([]*Anime, 0, len(c.watchList))
 	index := 1
 anime:
-	for malID, oldStatus := range c.watchList {
+	for malID, state := range c.watchList {
+		// requests fail once the rate limiter is stopped, do not count them as anime failures
+		if c.ctx.Err() != nil {
+			c.log.Infof("[MAL] [Watcher] updating state: interrupted: %v", c.ctx.Err())
+			return
+		}
+		oldStatus := state.Status
 		// only update the ones which need to
 		if oldStatus == animeStatusFinished {
 			continue
 		}
 		// get current details
-		try := 0
-		for {
-			// sometime the Jikkan API can have issues, we will retry until errorRetryMax is reached
-			try++
-			c.rateLimiter()
-			if animeDetails, err = jikan.GetAnime(malID); err == nil {
-				// no error let's get out of the loop
-				if try > 1 {
-					c.log.Infof("[MAL] [Watcher] updating state: [%d/%d] anime %d details recovered at try %d/%d",
-						index, len(c.watchList), malID, try, errorRetryMax)
-				}
-				break
-			}
-			if try == errorRetryMax {
-				c.log.Errorf("[MAL] [Watcher] updating state: [%d/%d] can't check current status of MalID %d (try %d/%d): %s",
-					index, len(c.watchList), malID, try, errorRetryMax, err)
-				continue anime
-			}
-			// let's retry when rateLimiter will allow us to
-			c.log.Warningf("[MAL] [Watcher] updating state: [%d/%d] can't check current status of MalID %d (try %d/%d): %s",
-				index, len(c.watchList), malID, try, errorRetryMax, err)
+		if animeDetails, err = c.getAnime(operationUpdateState, malID); err != nil {
+			c.log.Errorf("[MAL] [Watcher] updating state: [%d/%d] can't check current status of MalID %d: %v",
+				index, len(c.watchList), malID, err)
+			c.fetchFailed(malID, state, err)
+			index++
+			continue anime
 		}
 		// save filters data
 		c.update.Lock()
 		for _, genre := range animeDetails.Genres {
-			c.genres.Add(genre.Name)
+			c.genres.Add(genre)
 		}
 		c.ratings.Add(animeDetails.Rating)
 		c.types.Add(animeDetails.Type)
+		state.refresh(animeDetails)
+		c.persistAnime(malID)
 		c.update.Unlock()
 		// has status changed ?
 		if animeDetails.Status != oldStatus {
 			c.update.Lock()
-			c.watchList[malID] = animeDetails.Status
+			if animeDetails.Status == animeStatusFinished {
+				state.setFinished(animeDetails)
+			} else {
+				state.Status = animeDetails.Status
+			}
+			c.persistTransition(malID, oldStatus)
 			c.update.Unlock()
 			if animeDetails.Status == animeStatusFinished {
 				finished = append(finished, animeDetails)
@@ -270,37 +408,41 @@ anime:
 	return
 }
 
-func (c *Controller) findNewAnimes() {
+func (c *Controller) findNewAnimes() (err error) {
 	c.log.Info("[MAL] [Watcher] finding new animes (current season)...")
 	var (
-		seasonList   *jikan.Season
-		animeDetails *jikan.Anime
-		err          error
+		seasonList   []*Anime
+		animeDetails *Anime
 		found        bool
 		new          int
 	)
 	// Get current season
-	c.rateLimiter()
-	if seasonList, err = jikan.GetSeason(currentSeason()); err != nil {
+	year, season := currentSeason()
+	if seasonList, err = c.getSeason(operationFindNew, year, season); err != nil {
 		c.log.Errorf("[MAL] [Watcher] finding new animes (current season): can't get current season animes: %v", err)
-		return
+		return fmt.Errorf("can't get current season animes: %w", err)
 	}
 	// for each anime for this season
-	for _, anime := range seasonList.Anime {
+	for _, anime := range seasonList {
+		if c.ctx.Err() != nil {
+			c.log.Infof("[MAL] [Watcher] finding new animes (current season): interrupted: %v", c.ctx.Err())
+			return
+		}
 		if _, found = c.watchList[anime.MalID]; found {
 			continue
 		}
 		// get its status
-		c.rateLimiter()
-		if animeDetails, err = jikan.GetAnime(anime.MalID); err != nil {
+		var errDetails error
+		if animeDetails, errDetails = c.getAnime(operationFindNew, anime.MalID); errDetails != nil {
+			// it will be found again at next batch
 			c.log.Errorf("[MAL] [Watcher] finding new animes (current season): can't get details of a new anime ('%s' [%d]): %v",
-				anime.Title, anime.MalID, err)
+				anime.Title, anime.MalID, errDetails)
 			continue
 		}
 		// save filters data
 		c.update.Lock()
 		for _, genre := range animeDetails.Genres {
-			c.genres.Add(genre.Name)
+			c.genres.Add(genre)
 		}
 		c.ratings.Add(animeDetails.Rating)
 		c.types.Add(animeDetails.Type)
@@ -308,7 +450,8 @@ func (c *Controller) findNewAnimes() {
 		// handle status
 		if animeDetails.Status != animeStatusFinished {
 			c.update.Lock()
-			c.watchList[animeDetails.MalID] = animeDetails.Status
+			c.watchList[animeDetails.MalID] = newAnimeState(animeDetails)
+			c.persistTransition(animeDetails.MalID, "")
 			c.update.Unlock()
 			new++
 			c.log.Infof("[MAL] [Watcher] finding new animes (current season): a new (%s) anime has been found: '%s' (MalID %d)",
@@ -319,5 +462,6 @@ func (c *Controller) findNewAnimes() {
 		}
 	}
 	c.log.Infof("[MAL] [Watcher] finding new animes (current season): %d/%d new anime(s) added to the watch list",
-		new, len(seasonList.Anime))
+		new, len(seasonList))
+	return
 }
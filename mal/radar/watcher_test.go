@@ -0,0 +1,232 @@
+package radar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/hekmon/hllogger"
+)
+
+// recordingNotifier keeps the notifications it receives
+type recordingNotifier struct {
+	access sync.Mutex
+	notifs []Notification
+}
+
+func (rn *recordingNotifier) Name() string {
+	return "recorder"
+}
+
+func (rn *recordingNotifier) Notify(ctx context.Context, notif Notification) error {
+	rn.access.Lock()
+	defer rn.access.Unlock()
+	rn.notifs = append(rn.notifs, notif)
+	return nil
+}
+
+// notified returns the MalIDs of the animes notified so far
+func (rn *recordingNotifier) notified() (malIDs []int) {
+	rn.access.Lock()
+	defer rn.access.Unlock()
+	for _, notif := range rn.notifs {
+		if notif.Anime != nil {
+			malIDs = append(malIDs, notif.Anime.MalID)
+		}
+	}
+	return
+}
+
+// newTestController returns a controller using source and a JSON store within a temporary directory.
+// Its worker is not started: batches are run by the tests.
+func newTestController(t *testing.T, source AnimeSource, notifyInit bool) (c *Controller, notifier *recordingNotifier) {
+	t.Helper()
+	notifier = new(recordingNotifier)
+	p, err := newProfile(ProfileConfig{
+		Name:      DefaultProfile,
+		Notifiers: []Notifier{notifier},
+	})
+	if err != nil {
+		t.Fatalf("can't create profile: %v", err)
+	}
+	schedule, err := newSchedule(ScheduleConfig{})
+	if err != nil {
+		t.Fatalf("can't create schedule: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	logger := hllogger.New(io.Discard, &hllogger.Config{LogLevel: hllogger.Fatal})
+	dir := t.TempDir()
+	c = &Controller{
+		nbSeasons:       2,
+		notifyInit:      notifyInit,
+		initErrorPolicy: InitErrorSkip,
+		ctx:             ctx,
+		stateDir:        dir,
+		profiles:        []*profile{p},
+		schedule:        schedule,
+		source:          source,
+		trigger:         make(chan bool, 1),
+		stopped:         make(chan struct{}),
+		store:           newJSONStore(dir, logger),
+		metrics:         newMetrics(),
+		log:             logger,
+	}
+	if !c.load() {
+		t.Fatal("can't load the empty state")
+	}
+	return
+}
+
+// newTestSource returns a source with the current season containing an airing, a finished and a deleted anime
+// and the previous one a not yet aired anime and the airing one again
+func newTestSource() *fakeSource {
+	source := newFakeSource()
+	year, season := currentSeason()
+	source.AddToSeason(year, season, &Anime{MalID: 1, Title: "Airing", Status: animeStatusOnGoing})
+	source.AddToSeason(year, season, &Anime{MalID: 2, Title: "Finished", Status: animeStatusFinished})
+	source.AddToSeason(year, season, &Anime{MalID: 3, Title: "Deleted", Status: animeStatusOnGoing})
+	source.Fail(3, fmt.Errorf("anime 3: %w", ErrNotFound))
+	year, season = previousSeason(season, year)
+	source.AddToSeason(year, season, &Anime{MalID: 4, Title: "Not aired", Status: animeStatusNotAired})
+	source.AddToSeason(year, season, &Anime{MalID: 1, Title: "Airing", Status: animeStatusOnGoing})
+	return source
+}
+
+func checkWatchList(t *testing.T, c *Controller, expected map[int]string) {
+	t.Helper()
+	c.update.Lock()
+	defer c.update.Unlock()
+	if len(c.watchList) != len(expected) {
+		t.Errorf("watch list has %d anime(s), expected %d: %v", len(c.watchList), len(expected), c.watchList)
+	}
+	for malID, status := range expected {
+		if state := c.watchList[malID]; state == nil {
+			t.Errorf("MalID %d is not within the watch list", malID)
+		} else if state.Status != status {
+			t.Errorf("MalID %d status is '%s', expected '%s'", malID, state.Status, status)
+		}
+	}
+}
+
+func TestInitialBuild(t *testing.T) {
+	c, notifier := newTestController(t, newTestSource(), false)
+	c.batch(false)
+	checkWatchList(t, c, map[int]string{
+		1: animeStatusOnGoing,
+		4: animeStatusNotAired,
+	})
+	if notified := notifier.notified(); len(notified) != 0 {
+		t.Errorf("no backlog notifications expected, got %v", notified)
+	}
+	if c.lastBatch == nil || c.lastBatch.Error != "" {
+		t.Errorf("unexpected batch result: %+v", c.lastBatch)
+	}
+}
+
+func TestInitialBuildNotifyInit(t *testing.T) {
+	c, notifier := newTestController(t, newTestSource(), true)
+	c.batch(false)
+	if notified := notifier.notified(); len(notified) != 1 || notified[0] != 2 {
+		t.Errorf("expected the finished anime to be notified, got %v", notified)
+	}
+	// once notified, the finished anime is not needed anymore
+	checkWatchList(t, c, map[int]string{
+		1: animeStatusOnGoing,
+		4: animeStatusNotAired,
+	})
+}
+
+func TestStatusTransitions(t *testing.T) {
+	source := newTestSource()
+	c, notifier := newTestController(t, source, false)
+	c.batch(false)
+	source.Set(&Anime{MalID: 1, Title: "Airing", Status: animeStatusFinished})
+	source.Set(&Anime{MalID: 4, Title: "Not aired", Status: animeStatusOnGoing})
+	c.batch(false)
+	if notified := notifier.notified(); len(notified) != 1 || notified[0] != 1 {
+		t.Errorf("expected the freshly finished anime to be notified, got %v", notified)
+	}
+	checkWatchList(t, c, map[int]string{
+		4: animeStatusOnGoing,
+	})
+}
+
+func TestLedgerPreventsNotifyingAgain(t *testing.T) {
+	source := newTestSource()
+	c, notifier := newTestController(t, source, true)
+	c.batch(false)
+	source.Set(&Anime{MalID: 1, Title: "Airing", Status: animeStatusFinished})
+	c.batch(false)
+	if notified := notifier.notified(); !reflect.DeepEqual(notified, []int{2, 1}) {
+		t.Fatalf("expected the finished animes to be notified, got %v", notified)
+	}
+	// a rebuild with backlog notifications finds both finished animes again: the ledger suppresses them
+	c.batch(true)
+	if notified := notifier.notified(); len(notified) != 2 {
+		t.Errorf("expected no more notifications after the rebuild, got %v", notified)
+	}
+	// the ledger is kept per profile: a new profile still gets the backlog
+	late := new(recordingNotifier)
+	p, err := newProfile(ProfileConfig{
+		Name:      "late",
+		Notifiers: []Notifier{late},
+	})
+	if err != nil {
+		t.Fatalf("can't create profile: %v", err)
+	}
+	c.profiles = append(c.profiles, p)
+	c.batch(true)
+	if notified := late.notified(); len(notified) != 2 {
+		t.Errorf("expected the new profile to be notified of both finished animes, got %v", notified)
+	}
+	if notified := notifier.notified(); len(notified) != 2 {
+		t.Errorf("expected no more notifications for the default profile, got %v", notified)
+	}
+}
+
+func TestNotFoundDropsAnime(t *testing.T) {
+	source := newTestSource()
+	c, _ := newTestController(t, source, false)
+	c.batch(false)
+	source.Remove(4)
+	c.batch(false)
+	checkWatchList(t, c, map[int]string{
+		1: animeStatusOnGoing,
+	})
+}
+
+func TestIncompleteBatchIsNotSuccessful(t *testing.T) {
+	source := newTestSource()
+	c, _ := newTestController(t, source, false)
+	c.batch(false)
+	built := c.lastSuccess
+	if built.IsZero() {
+		t.Fatal("the initial build should be successful")
+	}
+	// the current season can't be fetched: new animes can't be found
+	source.FailSeasons(&httpStatusError{code: 403, status: "403 Forbidden"})
+	c.batch(false)
+	if c.lastBatch.Error == "" || !c.lastSuccess.Equal(built) {
+		t.Errorf("a batch failing to find new animes must not be successful: %+v", c.lastBatch)
+	}
+	source.FailSeasons(nil)
+	// interrupted batch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.ctx = ctx
+	c.batch(false)
+	if c.lastBatch.Error == "" || !c.lastSuccess.Equal(built) {
+		t.Errorf("an interrupted batch must not be successful: %+v", c.lastBatch)
+	}
+	state, err := c.store.loadSchedule()
+	if err != nil {
+		t.Fatalf("can't load the persisted schedule: %v", err)
+	}
+	if !state.LastSuccess.Equal(built) {
+		t.Errorf("persisted last success is %v, expected %v", state.LastSuccess, built)
+	}
+}
@@ -4,8 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
+// Client is the HTTP client used to query the user lists, it can be replaced to customize the transport
+var Client = &http.Client{
+	Timeout: 60 * time.Second,
+}
+
 const (
 	// MaxAnimesPerPage is the maximum number of items a single call to GetUserList() can return
 	MaxAnimesPerPage   = 300
@@ -36,7 +42,7 @@ func GetAllUserAnimes(user string) (animes List, err error) {
 // Use offset to request other pages and status to filter the results.
 func GetUserList(user string, status Status, offset int) (pageAnimes List, err error) {
 	url := fmt.Sprintf("https://myanimelist.net/animelist/%s/load.json?offset=%d&status=%d", user, offset, status)
-	response, err := http.Get(url)
+	response, err := Client.Get(url)
 	if err != nil {
 		err = fmt.Errorf("getting '%s' failed: %w", url, err)
 		return
@@ -102,3 +102,23 @@ const (
 	// StatusAll represents all the possible status for an anime in a user list (no filtering)
 	StatusAll Status = 7
 )
+
+// String returns the status as displayed on MyAnimeList
+func (s Status) String() string {
+	switch s {
+	case StatusWatching:
+		return "Watching"
+	case StatusCompleted:
+		return "Completed"
+	case StatusOnHold:
+		return "On Hold"
+	case StatusDropped:
+		return "Dropped"
+	case StatusPlanToWatch:
+		return "Plan to Watch"
+	case StatusAll:
+		return "All"
+	default:
+		return fmt.Sprintf("Unknown (%d)", int(s))
+	}
+}